@@ -0,0 +1,101 @@
+package raidman
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/amir/raidman/proto"
+)
+
+// ErrAckTimeout is returned by SendAwait when Riemann did not acknowledge
+// the event in time. The event may still have been delivered.
+var ErrAckTimeout = errors.New("raidman: timed out waiting for acknowledgement")
+
+// SendAwait sends an event to Riemann like Send, but waits for its
+// acknowledgement for ackTimeout rather than for the read timeout of c. The
+// write is bounded as usual, and fails like that of Send. If no
+// acknowledgement arrives in time, it returns ErrAckTimeout, though Riemann
+// may have received the event and only be slow to confirm it.
+//
+// A late acknowledgement would be mistaken for the response to the next
+// message, so after a timeout c dials a new connection, which later sends
+// use.
+//
+// Over UDP, and while falling back to UDP, there is no acknowledgement to
+// wait for and SendAwait is Send.
+func (c *Client) SendAwait(event *Event, ackTimeout time.Duration) error {
+	t, ok := c.net.(*tcp)
+	if !ok {
+		return c.Send(event)
+	}
+	events := []*Event{event}
+	message, err := c.message(events)
+	if err != nil || message == nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.DryRun || c.fallback != nil {
+		return c.sendMessage(events, message, time.Time{})
+	}
+	if err = c.awaitMessage(t, events, message, ackTimeout); err != nil {
+		c.stats.recordFailure(c.timeNow(), "send", err)
+		return err
+	}
+	c.stats.recordSent(c.timeNow(), len(message.Events))
+	return nil
+}
+
+// awaitMessage writes message, carrying events, over t and waits for its
+// acknowledgement for ackTimeout. Failures of the connection count towards
+// falling back to UDP as in sendMessage. The caller must hold the lock.
+func (c *Client) awaitMessage(t *tcp, events []*Event, message *proto.Msg, ackTimeout time.Duration) error {
+	if err := c.use(); err != nil {
+		return err
+	}
+	if err := c.setDeadline(c.connection, time.Time{}); err != nil {
+		return c.connError(err)
+	}
+	if err := t.write(message, c.tapped(c.connection)); err != nil {
+		// The event may not have left c, so this is no late
+		// acknowledgement, even if the write timed out.
+		if c.fallBack() {
+			return c.sendFallback(message, time.Time{})
+		}
+		return c.connError(err)
+	}
+	response, err := t.readWithin(c.connection, ackTimeout)
+	if err == nil {
+		if t.readTimeout <= 0 {
+			c.connection.SetReadDeadline(time.Time{})
+		}
+		c.failures = 0
+		return nil
+	}
+	if response != nil {
+		c.reject(events, response.GetError())
+		return err
+	}
+
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		if c.fallBack() {
+			return c.sendFallback(message, time.Time{})
+		}
+		return c.connError(err)
+	}
+
+	// The event may have been delivered, so it is not sent again over
+	// UDP, but the timeout counts as a failure all the same.
+	c.connection.Close()
+	if !c.fallBack() {
+		if conn, err := c.redial(); err == nil {
+			c.setConnection(conn)
+		} else {
+			c.idle = true
+		}
+	}
+	return ErrAckTimeout
+}
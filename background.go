@@ -0,0 +1,39 @@
+package raidman
+
+// goBackground runs f in a goroutine owned by c, which Close waits for. f
+// must return once c.done is closed. It returns false, running nothing, if c
+// is closed.
+func (c *Client) goBackground(f func()) bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return false
+	}
+	c.background.Add(1)
+	go func() {
+		defer c.background.Done()
+		f()
+	}()
+	return true
+}
+
+// stopBackground signals the goroutines of c to exit and waits for them.
+func (c *Client) stopBackground() {
+	c.Lock()
+	if !c.closed {
+		c.closed = true
+		if c.done != nil {
+			close(c.done)
+		}
+	}
+	c.Unlock()
+	c.background.Wait()
+}
+
+// backgroundError passes err, from a background goroutine of c, to the
+// ErrorHandler of c, if set.
+func (c *Client) backgroundError(err error) {
+	if err != nil && c.ErrorHandler != nil {
+		c.ErrorHandler(err)
+	}
+}
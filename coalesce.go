@@ -0,0 +1,67 @@
+package raidman
+
+import (
+	"sync"
+	"time"
+
+	"github.com/amir/raidman/proto"
+)
+
+// WithCoalescing makes a Client gather the events of concurrent sends while
+// one of them holds the connection, and send them in a single message once
+// it is released, saving writes under contention. A send then fails with the
+// whole batch it was coalesced into: if Riemann rejects any event, or the
+// connection fails, every send of the batch returns the error.
+func WithCoalescing() Option {
+	return func(c *Client) {
+		c.coalesce = new(coalescer)
+	}
+}
+
+// coalescer holds the sends waiting for the connection of a Client.
+type coalescer struct {
+	mu      sync.Mutex
+	pending []*pendingSend
+}
+
+type pendingSend struct {
+	events   []*Event
+	message  *proto.Msg
+	deadline time.Time
+	done     chan error
+}
+
+// sendCoalesced sends message, carrying events, in a batch with the other
+// sends waiting for the connection. Whichever send gets the lock first sends
+// the batch for all of them.
+func (c *Client) sendCoalesced(events []*Event, message *proto.Msg, deadline time.Time) error {
+	p := &pendingSend{events, message, deadline, make(chan error, 1)}
+	c.coalesce.mu.Lock()
+	c.coalesce.pending = append(c.coalesce.pending, p)
+	c.coalesce.mu.Unlock()
+
+	c.Lock()
+	c.coalesce.mu.Lock()
+	batch := c.coalesce.pending
+	c.coalesce.pending = nil
+	c.coalesce.mu.Unlock()
+	// An empty batch means an earlier holder of the lock sent p.
+	if len(batch) > 0 {
+		var all []*Event
+		combined := &proto.Msg{}
+		var earliest time.Time
+		for _, b := range batch {
+			all = append(all, b.events...)
+			combined.Events = append(combined.Events, b.message.Events...)
+			if !b.deadline.IsZero() && (earliest.IsZero() || b.deadline.Before(earliest)) {
+				earliest = b.deadline
+			}
+		}
+		err := c.sendMessage(all, combined, earliest)
+		for _, b := range batch {
+			b.done <- err
+		}
+	}
+	c.Unlock()
+	return <-p.done
+}
@@ -0,0 +1,55 @@
+package raidman
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+)
+
+// lastConnID is the identifier given to the latest connection dialed by any
+// Client, so that identifiers are unique within the process.
+var lastConnID uint64
+
+// setConnection makes conn the connection of c, under a new identifier, so
+// that it is no longer to be redialed. The caller must hold the lock, or own
+// c exclusively.
+func (c *Client) setConnection(conn net.Conn) {
+	c.connection = conn
+	c.idle = false
+	c.connID.Store(atomic.AddUint64(&lastConnID, 1))
+}
+
+// connError is an error of the connection identified by id.
+type connError struct {
+	id  uint64
+	err error
+}
+
+func (e *connError) Error() string {
+	return fmt.Sprintf("connection %d: %v", e.id, e.err)
+}
+
+func (e *connError) Unwrap() error { return e.err }
+
+// Timeout and Temporary keep e a net.Error when what it wraps is one.
+func (e *connError) Timeout() bool {
+	var netErr net.Error
+	return errors.As(e.err, &netErr) && netErr.Timeout()
+}
+
+func (e *connError) Temporary() bool {
+	var netErr net.Error
+	return errors.As(e.err, &netErr) && netErr.Temporary()
+}
+
+// connError returns err, if it is an error of the network, identifying the
+// connection of c it happened on. Other errors are returned as is.
+func (c *Client) connError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &connError{c.connID.Load(), err}
+	}
+	return err
+}
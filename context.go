@@ -0,0 +1,64 @@
+package raidman
+
+import (
+	"context"
+	"sync"
+)
+
+// A ContextExtractor returns attributes to attach to events sent with a
+// context, such as the trace or tenant of the request it belongs to.
+type ContextExtractor func(ctx context.Context) map[string]string
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   []ContextExtractor
+)
+
+// RegisterContextExtractor adds extractor to the extractors used by
+// SendContext of every Client.
+func RegisterContextExtractor(extractor ContextExtractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	extractors = append(extractors, extractor)
+}
+
+// SendContext sends an event to Riemann like Send, with the attributes
+// returned for ctx by the registered extractors and by c.ContextExtractor
+// merged into a copy of its attributes. Attributes already set on the event
+// take precedence, then those of c.ContextExtractor.
+//
+// The deadline of ctx, if any, bounds the send. Cancellation is only checked
+// before the send starts.
+func (c *Client) SendContext(ctx context.Context, event *Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	extractorsMu.RLock()
+	all := append([]ContextExtractor(nil), extractors...)
+	extractorsMu.RUnlock()
+	if c.ContextExtractor != nil {
+		all = append(all, c.ContextExtractor)
+	}
+
+	var attributes map[string]string
+	for _, extract := range all {
+		for k, v := range extract(ctx) {
+			if attributes == nil {
+				attributes = make(map[string]string)
+			}
+			attributes[k] = v
+		}
+	}
+	if attributes != nil && event != nil {
+		for k, v := range event.Attributes {
+			attributes[k] = v
+		}
+		e := *event
+		e.Attributes = attributes
+		event = &e
+	}
+
+	deadline, _ := ctx.Deadline()
+	return c.sendEvents([]*Event{event}, deadline)
+}
@@ -0,0 +1,111 @@
+package raidman
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type dedupKey struct {
+	service, host, state string
+}
+
+// DedupClient wraps a Client and suppresses events with the same service,
+// host and state as an event sent less than a window ago. Unlike
+// aggregation, suppressed events are dropped, not combined. It only exposes
+// the operations it deduplicates, so that no send bypasses it.
+type DedupClient struct {
+	client     *Client
+	window     time.Duration
+	suppressed atomic.Uint64
+
+	mu     sync.Mutex
+	seen   map[dedupKey]time.Time
+	pruned time.Time
+}
+
+// NewDedupClient returns a DedupClient sending through c and suppressing
+// repeats seen within window.
+func NewDedupClient(c *Client, window time.Duration) *DedupClient {
+	return &DedupClient{
+		client: c,
+		window: window,
+		seen:   make(map[dedupKey]time.Time),
+		pruned: c.timeNow(),
+	}
+}
+
+// Send sends an event to Riemann unless it repeats a recent one.
+func (d *DedupClient) Send(event *Event, opts ...SendOption) error {
+	return d.SendMulti([]*Event{event}, opts...)
+}
+
+// SendMulti sends the events that do not repeat a recent one to Riemann.
+// If the send fails, the events are forgotten so that retrying them is not
+// suppressed.
+func (d *DedupClient) SendMulti(events []*Event, opts ...SendOption) error {
+	now := d.client.timeNow()
+	fresh := make([]*Event, 0, len(events))
+	var keys []dedupKey
+
+	d.mu.Lock()
+	if now.Sub(d.pruned) > d.window {
+		for key, at := range d.seen {
+			if now.Sub(at) >= d.window {
+				delete(d.seen, key)
+			}
+		}
+		d.pruned = now
+	}
+	for _, event := range events {
+		if event == nil {
+			fresh = append(fresh, event)
+			continue
+		}
+		key := dedupKey{event.Service, event.Host, event.State}
+		if at, ok := d.seen[key]; ok && now.Sub(at) < d.window {
+			d.suppressed.Add(1)
+			continue
+		}
+		d.seen[key] = now
+		keys = append(keys, key)
+		fresh = append(fresh, event)
+	}
+	d.mu.Unlock()
+
+	if len(fresh) == 0 {
+		return nil
+	}
+	err := d.client.SendMulti(fresh, opts...)
+	if err != nil {
+		d.mu.Lock()
+		for _, key := range keys {
+			if d.seen[key] == now {
+				delete(d.seen, key)
+			}
+		}
+		d.mu.Unlock()
+	}
+	return err
+}
+
+// Query returns a list of events matched by query, through the wrapped
+// Client.
+func (d *DedupClient) Query(q string) ([]Event, error) {
+	return d.client.Query(q)
+}
+
+// Close closes the wrapped Client.
+func (d *DedupClient) Close() error {
+	return d.client.Close()
+}
+
+// Window returns the duration within which repeated events are suppressed.
+func (d *DedupClient) Window() time.Duration {
+	return d.window
+}
+
+// Suppressed returns the number of events suppressed as duplicates.
+func (d *DedupClient) Suppressed() uint64 {
+	return d.suppressed.Load()
+}
@@ -0,0 +1,31 @@
+package raidman
+
+import "github.com/amir/raidman/proto"
+
+// dryRun marshals message as c would send it, writing it to the TapWriter of
+// c if one is set, instead of to the connection. The caller must hold the
+// lock.
+func (c *Client) dryRun(message *proto.Msg) error {
+	var wire [][]byte
+	switch network := c.net.(type) {
+	case *tcp:
+		header, data, err := network.encode(message)
+		if err != nil {
+			return err
+		}
+		wire = [][]byte{header, data}
+	case *udp:
+		truncateDescriptions(message, c.udpDescriptionLimit)
+		data, err := marshalerOr(network.codec).Marshal(message)
+		if err != nil {
+			return err
+		}
+		wire = [][]byte{data}
+	}
+	if c.TapWriter != nil {
+		for _, b := range wire {
+			c.TapWriter.Write(b)
+		}
+	}
+	return nil
+}
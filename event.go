@@ -0,0 +1,282 @@
+package raidman
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Tags set by NewCounter and NewGauge to tell apart the two kinds of metric.
+const (
+	CounterTag = "counter"
+	GaugeTag   = "gauge"
+)
+
+// NewCounter returns an event for service carrying delta, the amount a
+// counter changed by, tagged with CounterTag.
+func NewCounter(service string, delta float64) *Event {
+	return &Event{
+		Service: service,
+		Metric:  delta,
+		Tags:    []string{CounterTag},
+	}
+}
+
+// NewGauge returns an event for service carrying value, the current value of
+// a gauge, tagged with GaugeTag.
+func NewGauge(service string, value float64) *Event {
+	return &Event{
+		Service: service,
+		Metric:  value,
+		Tags:    []string{GaugeTag},
+	}
+}
+
+// ExpiredState is the state of events Riemann removes from its index.
+const ExpiredState = "expired"
+
+// NewEphemeral returns an event for service that Riemann streams see but its
+// index does not keep. Riemann's index deletes the indexed event of the host
+// and service of an event in ExpiredState instead of updating it, so an
+// ephemeral event both never persists and clears any earlier state of its
+// service.
+func NewEphemeral(service string) *Event {
+	return &Event{
+		Service: service,
+		State:   ExpiredState,
+	}
+}
+
+// SetMetricDuration sets the metric of e to d in seconds, as a float64.
+func (e *Event) SetMetricDuration(d time.Duration) {
+	e.Metric = d.Seconds()
+}
+
+// SetMetricJSON sets the metric of e to n, as an int64 if n is an integer
+// that fits in one, e.g. "42" or "1e3", and as a float64 otherwise. It
+// returns an error, leaving the metric unchanged, if n is not a number.
+func (e *Event) SetMetricJSON(n json.Number) error {
+	if i, err := n.Int64(); err == nil {
+		e.Metric = i
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return fmt.Errorf("Metric %q is not a number", string(n))
+	}
+	if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		e.Metric = int64(f)
+	} else {
+		e.Metric = f
+	}
+	return nil
+}
+
+// MetricDuration returns the metric of e, a number of seconds, as a
+// duration. It returns false if e has no numeric metric.
+func (e *Event) MetricDuration() (time.Duration, bool) {
+	seconds, ok := e.MetricValue()
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// MetricValue returns the metric of e as a float64, whichever numeric type
+// it has, e.g. the int64, float32 or float64 of an event returned by Query.
+// It returns false if e has no numeric metric. Query gives events the server
+// sent without a metric an int64 zero, which QueryRaw tells apart.
+func (e *Event) MetricValue() (float64, bool) {
+	m := reflect.ValueOf(e.Metric)
+	switch m.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(m.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(m.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return m.Float(), true
+	}
+	return 0, false
+}
+
+// AttributeInt returns the attribute key of e parsed as a decimal integer. It
+// returns false if the attribute is missing or is not an integer.
+func (e *Event) AttributeInt(key string) (int64, bool) {
+	v, ok := e.Attributes[key]
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	return i, err == nil
+}
+
+// AttributeFloat returns the attribute key of e parsed as a floating-point
+// number. It returns false if the attribute is missing or is not a number.
+func (e *Event) AttributeFloat(key string) (float64, bool) {
+	v, ok := e.Attributes[key]
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	return f, err == nil
+}
+
+// AttributeBool returns the attribute key of e parsed as a boolean, as
+// accepted by strconv.ParseBool. It returns false if the attribute is missing
+// or is not a boolean.
+func (e *Event) AttributeBool(key string) (bool, bool) {
+	v, ok := e.Attributes[key]
+	if !ok {
+		return false, false
+	}
+	b, err := strconv.ParseBool(v)
+	return b, err == nil
+}
+
+// scaleMetric returns metric multiplied by factor, keeping its type unless
+// the result overflows it, when it is widened to int64 or uint64. Integer
+// metrics are truncated toward zero. Metrics of non-numeric types are
+// returned unchanged.
+func scaleMetric(metric interface{}, factor float64) interface{} {
+	if metric == nil {
+		return nil
+	}
+	v := reflect.ValueOf(metric)
+	scaled := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := int64(float64(v.Int()) * factor)
+		if scaled.OverflowInt(i) {
+			return i
+		}
+		scaled.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := uint64(float64(v.Uint()) * factor)
+		if scaled.OverflowUint(u) {
+			return u
+		}
+		scaled.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		scaled.SetFloat(v.Float() * factor)
+	default:
+		return metric
+	}
+	return scaled.Interface()
+}
+
+// SetBinaryAttribute sets the attribute key of e to data, encoded in
+// standard base64 as attributes are strings.
+func (e *Event) SetBinaryAttribute(key string, data []byte) {
+	if e.Attributes == nil {
+		e.Attributes = make(map[string]string)
+	}
+	e.Attributes[key] = base64.StdEncoding.EncodeToString(data)
+}
+
+// BinaryAttribute returns the attribute key of e decoded from standard
+// base64. It returns false if the attribute is missing or is not base64.
+func (e *Event) BinaryAttribute(key string) ([]byte, bool) {
+	v, ok := e.Attributes[key]
+	if !ok {
+		return nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(v)
+	return data, err == nil
+}
+
+// Merge merges other into e, as an enrichment stage would:
+//
+//   - each of Ttl, Time, TimeMicros, Host, State, Service, Metric and
+//     Description is taken from other unless it is zero or nil there;
+//   - NoPrefix is set if it is set in either;
+//   - ClearMetric is set if it is set in either, and if set in other, the
+//     Metric of e is dropped;
+//   - Tags become the union of both, those of e first, without duplicates;
+//   - Attributes are merged, other winning for keys present in both.
+//
+// other is not modified, nor does e share its tags or attributes.
+func (e *Event) Merge(other *Event) {
+	if other.Ttl != 0 {
+		e.Ttl = other.Ttl
+	}
+	if other.Time != 0 {
+		e.Time = other.Time
+	}
+	if other.TimeMicros != 0 {
+		e.TimeMicros = other.TimeMicros
+	}
+	if other.Host != "" {
+		e.Host = other.Host
+	}
+	if other.State != "" {
+		e.State = other.State
+	}
+	if other.Service != "" {
+		e.Service = other.Service
+	}
+	if other.Metric != nil {
+		e.Metric = other.Metric
+	}
+	if other.Description != "" {
+		e.Description = other.Description
+	}
+	e.NoPrefix = e.NoPrefix || other.NoPrefix
+	if other.ClearMetric {
+		e.Metric = nil
+		e.ClearMetric = true
+	}
+
+	for _, tag := range other.Tags {
+		found := false
+		for _, t := range e.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			e.Tags = append(e.Tags[:len(e.Tags):len(e.Tags)], tag)
+		}
+	}
+
+	if len(other.Attributes) > 0 {
+		attributes := make(map[string]string, len(e.Attributes)+len(other.Attributes))
+		for k, v := range e.Attributes {
+			attributes[k] = v
+		}
+		for k, v := range other.Attributes {
+			attributes[k] = v
+		}
+		e.Attributes = attributes
+	}
+}
+
+// Validate returns an error if e cannot be sent to Riemann, because it is nil
+// or its metric is not a number that fits in an int64 or a float.
+func (e *Event) Validate() error {
+	if e == nil {
+		return ErrNilEvent
+	}
+	if e.Metric == nil {
+		return nil
+	}
+	v := reflect.ValueOf(e.Metric)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return checkUint64(v.Uint())
+	}
+	return fmt.Errorf("Metric of invalid type (type %v)", v.Kind())
+}
+
+func checkUint64(m uint64) error {
+	if m > math.MaxInt64 {
+		return fmt.Errorf("Metric %d overflows int64", m)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package raidman
+
+import "time"
+
+// recentFailures is the number of failures a Client remembers.
+const recentFailures = 32
+
+// A FailureRecord describes a failed operation of a Client.
+type FailureRecord struct {
+	Time time.Time
+	// Op is the failed operation: "send" or "query".
+	Op  string
+	Err error
+}
+
+// failureRing holds the last recentFailures failures.
+type failureRing struct {
+	records [recentFailures]FailureRecord
+	next    int // index of the next record to write
+	n       int // number of records held
+}
+
+func (r *failureRing) add(record FailureRecord) {
+	r.records[r.next] = record
+	r.next = (r.next + 1) % recentFailures
+	if r.n < recentFailures {
+		r.n++
+	}
+}
+
+// recent returns the last n records held, most recent first.
+func (r *failureRing) recent(n int) []FailureRecord {
+	if n > r.n {
+		n = r.n
+	}
+	if n <= 0 {
+		return nil
+	}
+	records := make([]FailureRecord, n)
+	for i := range records {
+		records[i] = r.records[(r.next-1-i+recentFailures)%recentFailures]
+	}
+	return records
+}
+
+// recordFailure records that op failed with err at now, unless err is nil.
+func (s *clientStats) recordFailure(now time.Time, op string, err error) {
+	if err == nil {
+		return
+	}
+	s.Lock()
+	s.failures.add(FailureRecord{Time: now, Op: op, Err: err})
+	s.Unlock()
+}
+
+// RecentErrors returns the last n failures of sends and queries of c, most
+// recent first. At most the last 32 failures are remembered.
+func (c *Client) RecentErrors(n int) []FailureRecord {
+	c.stats.Lock()
+	defer c.stats.Unlock()
+	return c.stats.failures.recent(n)
+}
@@ -0,0 +1,109 @@
+package raidman
+
+import (
+	"strings"
+	"time"
+
+	"github.com/amir/raidman/proto"
+)
+
+// A Mode is the transport a Client currently sends events over.
+type Mode int
+
+const (
+	// Normal means events are sent over the network the Client was dialed
+	// with.
+	Normal Mode = iota
+	// UDPFallback means a TCP Client failed repeatedly and sends events
+	// over UDP, on a best-effort basis, until TCP works again.
+	UDPFallback
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Normal:
+		return "normal"
+	case UDPFallback:
+		return "udp-fallback"
+	}
+	return "unknown"
+}
+
+// WithUDPFallback makes a TCP Client fall back to sending events over UDP to
+// the same address after failures consecutive failed sends. While falling
+// back, the Client tries to reconnect over TCP when a send happens at least
+// retry after the previous attempt, and returns to TCP once it succeeds.
+// Queries fail while falling back.
+//
+// It has no effect on UDP clients.
+func WithUDPFallback(failures int, retry time.Duration) Option {
+	return func(c *Client) {
+		c.fallbackAfter = failures
+		c.fallbackRetry = retry
+	}
+}
+
+// Mode returns the transport c currently sends events over.
+func (c *Client) Mode() Mode {
+	c.Lock()
+	defer c.Unlock()
+	if c.fallback != nil {
+		return UDPFallback
+	}
+	return Normal
+}
+
+// fallBack records a failed send and reports whether c has started falling
+// back to UDP. The caller must hold the lock.
+func (c *Client) fallBack() bool {
+	if _, ok := c.net.(*tcp); !ok || c.fallbackAfter <= 0 {
+		return false
+	}
+	// Falling back would send in the clear what was meant for TLS.
+	if c.tlsConfig != nil {
+		return false
+	}
+
+	c.failures++
+	if c.failures < c.fallbackAfter {
+		return false
+	}
+
+	conn, err := c.dialNetwork("udp" + strings.TrimPrefix(c.netwrk, "tcp"))
+	if err != nil {
+		return false
+	}
+	c.fallback = conn
+	c.fallbackRetried = c.timeNow()
+	return true
+}
+
+// sendFallback sends message over UDP, unless it is time to retry TCP and
+// reconnecting succeeds. Unless it is zero, deadline bounds the send along
+// the timeout of c. The caller must hold the lock.
+func (c *Client) sendFallback(message *proto.Msg, deadline time.Time) error {
+	if c.timeNow().Sub(c.fallbackRetried) >= c.fallbackRetry {
+		c.fallbackRetried = c.timeNow()
+		if conn, err := c.redial(); err == nil {
+			c.connection.Close()
+			c.setConnection(conn)
+			c.fallback.Close()
+			c.fallback = nil
+			c.failures = 0
+			_, err = c.send(message, deadline)
+			return err
+		}
+	}
+
+	if err := c.setDeadline(c.fallback, deadline); err != nil {
+		return err
+	}
+	if !deadline.IsZero() {
+		defer c.fallback.SetDeadline(time.Time{})
+	}
+
+	truncateDescriptions(message, c.udpDescriptionLimit)
+	fallback := &udp{codec: c.net.(*tcp).codec}
+	_, err := fallback.Send(message, c.tapped(c.fallback))
+	return err
+}
@@ -0,0 +1,88 @@
+package raidman
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// A Sender sends events, such as a Client, one of its wrappers or a
+// FileSink, so that code producing events does not depend on where they go.
+type Sender interface {
+	Send(event *Event, opts ...SendOption) error
+	SendMulti(events []*Event, opts ...SendOption) error
+}
+
+// A FileSink is a Sender writing events to an io.Writer as newline-delimited
+// JSON, one event per line, rather than sending them to Riemann, e.g. to
+// record them for offline analysis or replay with UnmarshalEvents.
+type FileSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewFileSink returns a FileSink writing to w. Writes to w are serialized.
+func NewFileSink(w io.Writer) *FileSink {
+	return &FileSink{w: w}
+}
+
+// Send writes an event as a JSON line.
+func (s *FileSink) Send(event *Event, opts ...SendOption) error {
+	return s.SendMulti([]*Event{event}, opts...)
+}
+
+// SendMulti writes events as JSON lines, in a single write. As with a
+// Client, nil and empty events are skipped, and if events holds nothing but
+// nil events, it returns ErrNilEvent. WithSendTimeout has no effect.
+func (s *FileSink) SendMulti(events []*Event, opts ...SendOption) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	nils := 0
+	for _, event := range newSendOptions(opts).events(events) {
+		if event == nil {
+			nils++
+			continue
+		}
+		if event.isEmpty() {
+			continue
+		}
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+	if nils > 0 && nils == len(events) {
+		return ErrNilEvent
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(b.Bytes())
+	return err
+}
+
+// UnmarshalEvents reads the events written as JSON lines by a FileSink from
+// r, until its end. Integer metrics are read back as int64 and the others as
+// float64.
+func UnmarshalEvents(r io.Reader) ([]*Event, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var events []*Event
+	for {
+		event := new(Event)
+		if err := dec.Decode(event); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return events, err
+		}
+		if n, ok := event.Metric.(json.Number); ok {
+			if err := event.SetMetricJSON(n); err != nil {
+				return events, err
+			}
+		}
+		events = append(events, event)
+	}
+}
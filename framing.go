@@ -0,0 +1,22 @@
+package raidman
+
+import (
+	"net"
+
+	"github.com/amir/raidman/proto"
+)
+
+// ReadMsg reads a message from conn as framed over TCP by Riemann: a 4 byte
+// big endian length prefix followed by the message encoded with protobuf.
+// Unlike the responses a Client reads, the message is returned as is even
+// if it is not ok, so that both sides of a connection can use ReadMsg, e.g.
+// in a relay.
+func ReadMsg(conn net.Conn) (*proto.Msg, error) {
+	return new(tcp).readMsg(conn)
+}
+
+// WriteMsg writes msg to conn as framed over TCP by Riemann, as ReadMsg
+// reads it.
+func WriteMsg(conn net.Conn, msg *proto.Msg) error {
+	return new(tcp).write(msg, conn)
+}
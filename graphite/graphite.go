@@ -0,0 +1,89 @@
+// Package graphite exports raidman events to Graphite, in its plaintext line
+// protocol, for dashboards that still read from Graphite.
+package graphite
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amir/raidman"
+)
+
+// Format renders event as a line of the Graphite plaintext protocol,
+// "service value timestamp\n". The dots of the service are kept as path
+// separators and whitespace in it is replaced with underscores. The
+// timestamp is the time of event in seconds, or now if it has none. Events
+// without a numeric metric have no Graphite representation: Format returns
+// "" for them.
+func Format(event *raidman.Event) string {
+	var value string
+	metric := reflect.ValueOf(event.Metric)
+	switch metric.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value = strconv.FormatInt(metric.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value = strconv.FormatUint(metric.Uint(), 10)
+	case reflect.Float32:
+		value = strconv.FormatFloat(metric.Float(), 'f', -1, 32)
+	case reflect.Float64:
+		value = strconv.FormatFloat(metric.Float(), 'f', -1, 64)
+	default:
+		return ""
+	}
+
+	timestamp := event.Time
+	if event.TimeMicros != 0 {
+		timestamp = event.TimeMicros / 1e6
+	}
+	if timestamp == 0 {
+		timestamp = time.Now().Unix()
+	}
+
+	path := strings.Join(strings.Fields(event.Service), "_")
+	return fmt.Sprintf("%s %s %d\n", path, value, timestamp)
+}
+
+// A Writer sends events to a Graphite server over TCP. It is safe for
+// concurrent use.
+type Writer struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// Dial establishes a connection to the Graphite plaintext listener at addr,
+// usually on port 2003.
+func Dial(addr string) (*Writer, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{conn: conn}, nil
+}
+
+// Write sends events to Graphite, skipping those Format cannot render.
+// Graphite does not acknowledge them.
+func (w *Writer) Write(events ...*raidman.Event) error {
+	var b strings.Builder
+	for _, event := range events {
+		if event != nil {
+			b.WriteString(Format(event))
+		}
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.conn.Write([]byte(b.String()))
+	return err
+}
+
+// Close closes the connection to Graphite.
+func (w *Writer) Close() error {
+	return w.conn.Close()
+}
@@ -0,0 +1,65 @@
+package graphite_test
+
+import (
+	"bufio"
+	"net"
+	"testing"
+
+	"github.com/amir/raidman"
+	"github.com/amir/raidman/graphite"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		event    raidman.Event
+		expected string
+	}{
+		{raidman.Event{Service: "web.requests", Metric: 42, Time: 1500000000}, "web.requests 42 1500000000\n"},
+		{raidman.Event{Service: "go gc pause", Metric: 0.25, TimeMicros: 1500000000123456}, "go_gc_pause 0.25 1500000000\n"},
+		{raidman.Event{Service: "no.metric", Time: 1500000000}, ""},
+	}
+	for _, test := range tests {
+		if line := graphite.Format(&test.event); line != test.expected {
+			t.Errorf("Format(%+v) is %q, want %q", test.event, line, test.expected)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+	lines := make(chan string, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	w, err := graphite.Dial(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer w.Close()
+	err = w.Write(
+		&raidman.Event{Service: "a", Metric: 1, Time: 10},
+		&raidman.Event{Service: "skipped", Time: 10},
+		&raidman.Event{Service: "b", Metric: 2, Time: 20},
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, expected := range []string{"a 1 10", "b 2 20"} {
+		if line := <-lines; line != expected {
+			t.Errorf("Graphite received %q, want %q", line, expected)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package raidman
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultReportTTLMultiplier is the ratio of the ttl of reported events to
+// the reporting interval, unless set by WithReportTTLMultiplier.
+const defaultReportTTLMultiplier = 2.5
+
+// reportTTL returns the ttl of the events reported every interval by c.
+func (c *Client) reportTTL(interval time.Duration) float32 {
+	multiplier := c.reportTTLMultiplier
+	if multiplier <= 0 {
+		multiplier = defaultReportTTLMultiplier
+	}
+	return float32(multiplier * interval.Seconds())
+}
+
+// StartHeartbeat sends an "ok" event for service with the given ttl right
+// away and then every interval, until the returned stop function is called.
+// Stop waits for the heartbeat goroutine to exit and may be called more than
+// once. Closing c stops the heartbeat too.
+//
+// Riemann expires the event when no heartbeat arrives within ttl, so choose a
+// ttl somewhat longer than interval, e.g. twice as long, so that a single
+// late or lost heartbeat does not raise an alert. A zero ttl is derived from
+// interval as set by WithReportTTLMultiplier.
+func (c *Client) StartHeartbeat(service string, ttl float32, interval time.Duration) (stop func()) {
+	if ttl == 0 {
+		ttl = c.reportTTL(interval)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	started := c.goBackground(func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			c.backgroundError(c.Send(&Event{
+				Service: service,
+				State:   "ok",
+				Ttl:     ttl,
+			}))
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			case <-c.done:
+				return
+			}
+		}
+	})
+	if !started {
+		close(stopped)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
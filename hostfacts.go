@@ -0,0 +1,83 @@
+package raidman
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/amir/raidman/proto"
+	pb "github.com/golang/protobuf/proto"
+)
+
+// WithHostFacts makes a Client attach facts about the host to every event it
+// sends, as the attributes "os" and "arch", from the Go runtime, and where
+// available "kernel", from /proc, and "distribution", the PRETTY_NAME of
+// /etc/os-release. The facts are gathered once, on first use. Attributes of
+// the event take precedence.
+func WithHostFacts() Option {
+	return func(c *Client) {
+		c.hostFacts = true
+	}
+}
+
+var (
+	hostFactsOnce sync.Once
+	hostFacts     []*proto.Attribute
+)
+
+// loadHostFacts returns the facts about the host, gathering them the first
+// time.
+func loadHostFacts() []*proto.Attribute {
+	hostFactsOnce.Do(func() {
+		facts := [][2]string{{"os", runtime.GOOS}, {"arch", runtime.GOARCH}}
+		if kernel, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+			facts = append(facts, [2]string{"kernel", strings.TrimSpace(string(kernel))})
+		}
+		if name := osReleaseName("/etc/os-release"); name != "" {
+			facts = append(facts, [2]string{"distribution", name})
+		}
+		for _, fact := range facts {
+			hostFacts = append(hostFacts, &proto.Attribute{
+				Key:   pb.String(fact[0]),
+				Value: pb.String(fact[1]),
+			})
+		}
+	})
+	return hostFacts
+}
+
+// osReleaseName returns the PRETTY_NAME of the os-release file at path, or
+// "" if it cannot be read.
+func osReleaseName(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "PRETTY_NAME="); ok {
+			return strings.Trim(value, `"'`)
+		}
+	}
+	return ""
+}
+
+// addHostFacts adds the facts about the host to e, keeping the attributes
+// it already has.
+func addHostFacts(e *proto.Event) {
+	for _, fact := range loadHostFacts() {
+		found := false
+		for _, attr := range e.Attributes {
+			if attr.GetKey() == fact.GetKey() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			e.Attributes = append(e.Attributes, fact)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package raidman
+
+import "errors"
+
+// An OversizePolicy decides what a HybridClient does with events sent fast
+// that are too large for a UDP datagram.
+type OversizePolicy int
+
+const (
+	// OversizeError fails the send with ErrOversize.
+	OversizeError OversizePolicy = iota
+	// OversizeDrop discards the event, and the send succeeds.
+	OversizeDrop
+	// OversizeTCP sends the event over the TCP connection instead, and
+	// returns once Riemann acknowledged it as SendReliable does.
+	OversizeTCP
+)
+
+// HybridClient holds both a TCP and a UDP connection to a Riemann server, so
+// that each event can be sent either reliably or as cheaply as possible.
+type HybridClient struct {
+	// OnOversize decides what SendFast does with events too large for
+	// UDP. It must be set before h is used.
+	OnOversize OversizePolicy
+
+	reliable *Client
+	fast     *Client
+}
+
+// DialHybrid establishes a TCP and a UDP connection to the Riemann server at
+// addr, both configured by opts.
+func DialHybrid(addr string, opts ...Option) (*HybridClient, error) {
+	reliable, err := DialWithOptions("tcp", addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	fast, err := DialWithOptions("udp", addr, opts...)
+	if err != nil {
+		reliable.Close()
+		return nil, err
+	}
+	return &HybridClient{reliable: reliable, fast: fast}, nil
+}
+
+// SendReliable sends an event to Riemann over TCP, and returns once Riemann
+// acknowledged it.
+func (h *HybridClient) SendReliable(event *Event) error {
+	return h.reliable.Send(event)
+}
+
+// SendFast sends an event to Riemann over UDP, without waiting for any
+// acknowledgement. Events too large for UDP are handled as OnOversize
+// decides.
+func (h *HybridClient) SendFast(event *Event) error {
+	err := h.fast.Send(event)
+	if !errors.Is(err, ErrOversize) {
+		return err
+	}
+	switch h.OnOversize {
+	case OversizeDrop:
+		return nil
+	case OversizeTCP:
+		return h.reliable.Send(event)
+	}
+	return err
+}
+
+// Duplicated reports the outcome of SendDuplicated on each transport.
+type Duplicated struct {
+	Reliable error // nil if Riemann acknowledged the event over TCP
+	Fast     error // nil if the event was handed to the system over UDP
+}
+
+// SendDuplicated sends an event to Riemann over both UDP and TCP, so that the
+// UDP copy arrives early even when the TCP acknowledgement is slow. It
+// returns an error only if both sends failed; Riemann receives the event
+// twice when both succeed.
+func (h *HybridClient) SendDuplicated(event *Event) (Duplicated, error) {
+	var d Duplicated
+	d.Fast = h.fast.Send(event)
+	d.Reliable = h.reliable.Send(event)
+	if d.Fast != nil && d.Reliable != nil {
+		return d, d.Reliable
+	}
+	return d, nil
+}
+
+// Query returns a list of events matched by query, over TCP.
+func (h *HybridClient) Query(q string) ([]Event, error) {
+	return h.reliable.Query(q)
+}
+
+// Close closes both connections to Riemann.
+func (h *HybridClient) Close() error {
+	err := h.reliable.Close()
+	if ferr := h.fast.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
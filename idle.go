@@ -0,0 +1,58 @@
+package raidman
+
+import "time"
+
+// WithIdleTimeout closes the connection of a Client once it has not been used
+// for timeout, to spare server resources and avoid failing on a connection an
+// intermediary dropped. The next send or query dials a new connection.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.idleTimeout = timeout
+	}
+}
+
+// startIdleTimer starts watching c for idleness if it was configured to.
+func (c *Client) startIdleTimer() {
+	if c.idleTimeout <= 0 {
+		return
+	}
+	c.lastUse = c.timeNow()
+	c.idleTimer = time.AfterFunc(c.idleTimeout, c.closeIdle)
+}
+
+// closeIdle closes the connection of c if it has been idle for long enough,
+// and otherwise checks again when it would be.
+func (c *Client) closeIdle() {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed || c.idle {
+		return
+	}
+	if idle := c.timeNow().Sub(c.lastUse); idle < c.idleTimeout {
+		c.idleTimer.Reset(c.idleTimeout - idle)
+		return
+	}
+	c.connection.Close()
+	c.idle = true
+}
+
+// use records that c is being used, dialing a new connection first if the
+// previous one was closed for being idle or after a failure, unless c is
+// falling back to UDP and retries TCP on its own. The caller must hold the
+// lock.
+func (c *Client) use() error {
+	if c.idle && c.fallback == nil {
+		conn, err := c.redial()
+		if err != nil {
+			return err
+		}
+		c.setConnection(conn)
+		if c.idleTimer != nil {
+			c.idleTimer.Reset(c.idleTimeout)
+		}
+	}
+	if c.idleTimeout > 0 {
+		c.lastUse = c.timeNow()
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package raidman
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBounds are the upper bounds of the buckets of write latencies,
+// the last bucket holding the longer ones.
+var latencyBounds = [...]time.Duration{
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// WithWriteLatency makes a Client record how long each message it sends
+// takes to be written and, over TCP, acknowledged, as reported by the
+// WriteLatency of its Stats. Recording is off by default to spare its
+// overhead.
+func WithWriteLatency() Option {
+	return func(c *Client) {
+		c.latency = new(latencyHistogram)
+	}
+}
+
+// A LatencyHistogram counts durations in fixed buckets.
+type LatencyHistogram struct {
+	// Bounds are the upper bounds of the buckets, in increasing order.
+	Bounds []time.Duration
+	// Counts are the numbers of durations in each bucket: Counts[i]
+	// counts those up to Bounds[i] and longer than the previous bound,
+	// and the last count, after the last bound, those longer than every
+	// bound.
+	Counts []uint64
+}
+
+// Total returns the number of durations in h.
+func (h LatencyHistogram) Total() uint64 {
+	var total uint64
+	for _, n := range h.Counts {
+		total += n
+	}
+	return total
+}
+
+// Quantile returns the upper bound of the bucket the quantile q of the
+// durations in h falls in, such as 0.99 for the 99th percentile, or the last
+// bound if it falls after it. It returns 0 if h is empty.
+func (h LatencyHistogram) Quantile(q float64) time.Duration {
+	total := h.Total()
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range h.Counts {
+		seen += n
+		if seen >= rank && i < len(h.Bounds) {
+			return h.Bounds[i]
+		}
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// latencyHistogram records latencies in the buckets of latencyBounds
+// without locking.
+type latencyHistogram struct {
+	counts [len(latencyBounds) + 1]atomic.Uint64 // the last for longer latencies
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	i := 0
+	for i < len(latencyBounds) && d > latencyBounds[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+}
+
+// snapshot returns the latencies recorded so far. It is empty if h is nil.
+func (h *latencyHistogram) snapshot() LatencyHistogram {
+	if h == nil {
+		return LatencyHistogram{}
+	}
+	counts := make([]uint64, len(h.counts))
+	for i := range h.counts {
+		counts[i] = h.counts[i].Load()
+	}
+	bounds := latencyBounds
+	return LatencyHistogram{Bounds: bounds[:], Counts: counts}
+}
@@ -0,0 +1,45 @@
+package raidman
+
+import (
+	"github.com/amir/raidman/proto"
+	pb "github.com/golang/protobuf/proto"
+)
+
+// A Marshaler encodes the messages a Client sends and decodes the responses
+// of Riemann, in the protocol buffer format Riemann speaks.
+type Marshaler interface {
+	Marshal(msg *proto.Msg) ([]byte, error)
+	Unmarshal(data []byte, msg *proto.Msg) error
+}
+
+// protoMarshaler is the Marshaler of the protobuf library, used by default.
+type protoMarshaler struct{}
+
+func (protoMarshaler) Marshal(msg *proto.Msg) ([]byte, error) {
+	return pb.Marshal(msg)
+}
+
+func (protoMarshaler) Unmarshal(data []byte, msg *proto.Msg) error {
+	return pb.Unmarshal(data, msg)
+}
+
+// WithMarshaler makes a Client encode and decode messages with m instead of
+// the protobuf library, e.g. to inject faults or log messages in tests.
+func WithMarshaler(m Marshaler) Option {
+	return func(c *Client) {
+		switch network := c.net.(type) {
+		case *tcp:
+			network.codec = m
+		case *udp:
+			network.codec = m
+		}
+	}
+}
+
+// marshalerOr returns m, or the default Marshaler if m is nil.
+func marshalerOr(m Marshaler) Marshaler {
+	if m == nil {
+		return protoMarshaler{}
+	}
+	return m
+}
@@ -0,0 +1,168 @@
+package raidman
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/amir/raidman/proto"
+)
+
+// maxMuxInFlight is the number of messages a Mux writes before waiting for
+// the acknowledgement of the first of them.
+const maxMuxInFlight = 1024
+
+// errMuxClosed is returned by sends on a closed Mux.
+var errMuxClosed = errors.New("raidman: mux closed")
+
+// A Mux shares a single TCP connection to Riemann between many goroutines
+// without making each of them wait for the acknowledgements of the others: it
+// writes the messages of concurrent sends one after the other, and since
+// Riemann answers them in order, routes each acknowledgement back to the
+// send waiting for it.
+//
+// When the connection fails, every pending and later send fails with the
+// error of the connection: a Mux does not reconnect.
+type Mux struct {
+	c       *Client
+	t       *tcp
+	writeMu sync.Mutex
+	pending chan chan muxResult
+
+	failOnce sync.Once
+	failed   chan struct{} // closed once err is set
+	err      error
+	stopped  chan struct{} // closed once the reader exits
+}
+
+type muxResult struct {
+	response *proto.Msg
+	err      error
+}
+
+// DialMux establishes a connection to a Riemann server at addr, on the TCP
+// network netwrk, configured by opts, and returns a Mux sharing it. Options
+// about reconnecting and the transport, such as WithProbe and
+// WithUDPFallback, have no effect on a Mux.
+func DialMux(netwrk, addr string, opts ...Option) (*Mux, error) {
+	c, err := DialWithOptions(netwrk, addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := c.net.(*tcp)
+	if !ok {
+		c.Close()
+		return nil, fmt.Errorf("dial %q: a Mux needs a TCP network, not %q", addr, netwrk)
+	}
+	c.stopBackground()
+
+	m := &Mux{
+		c:       c,
+		t:       t,
+		pending: make(chan chan muxResult, maxMuxInFlight),
+		failed:  make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go m.read()
+	return m, nil
+}
+
+// Send sends an event to Riemann, and returns once Riemann acknowledged it.
+func (m *Mux) Send(event *Event) error {
+	return m.SendMulti([]*Event{event})
+}
+
+// SendMulti sends multiple events to Riemann in a single message, and
+// returns once Riemann acknowledged them.
+func (m *Mux) SendMulti(events []*Event) error {
+	message, err := m.c.message(events)
+	if err != nil || message == nil {
+		return err
+	}
+	result := make(chan muxResult, 1)
+
+	m.writeMu.Lock()
+	select {
+	case <-m.failed:
+		m.writeMu.Unlock()
+		return m.err
+	default:
+	}
+	select {
+	case m.pending <- result:
+	case <-m.failed:
+		m.writeMu.Unlock()
+		return m.err
+	}
+	if err = m.t.write(message, m.c.tapped(m.c.connection)); err != nil {
+		// The reader fails to read the acknowledgement too, and
+		// passes the error of the connection on below.
+		m.fail(m.c.connError(err))
+	}
+	m.writeMu.Unlock()
+
+	r := <-result
+	if r.err != nil {
+		if r.response != nil {
+			m.c.reject(events, r.response.GetError())
+		}
+		return r.err
+	}
+	m.c.stats.recordSent(m.c.timeNow(), len(message.Events))
+	return nil
+}
+
+// read routes each acknowledgement to the oldest pending send, until the
+// connection fails.
+func (m *Mux) read() {
+	defer close(m.stopped)
+	for {
+		var result chan muxResult
+		select {
+		case result = <-m.pending:
+		case <-m.failed:
+			m.drain()
+			return
+		}
+		response, err := m.t.read(m.c.connection)
+		if response == nil {
+			m.fail(m.c.connError(err))
+			result <- muxResult{nil, m.err}
+			m.drain()
+			return
+		}
+		result <- muxResult{response, err}
+	}
+}
+
+// fail makes every pending and later send fail with err, unless the Mux
+// already failed, and closes the connection.
+func (m *Mux) fail(err error) {
+	m.failOnce.Do(func() {
+		m.err = err
+		close(m.failed)
+		m.c.connection.Close()
+	})
+}
+
+// drain fails the sends still waiting for an acknowledgement once the Mux
+// failed. No send is queued while it holds the write lock.
+func (m *Mux) drain() {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	for {
+		select {
+		case result := <-m.pending:
+			result <- muxResult{nil, m.err}
+		default:
+			return
+		}
+	}
+}
+
+// Close closes the connection to Riemann. Pending sends fail.
+func (m *Mux) Close() error {
+	m.fail(errMuxClosed)
+	<-m.stopped
+	return nil
+}
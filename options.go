@@ -0,0 +1,160 @@
+package raidman
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// An Option configures a Client created by DialWithOptions.
+type Option func(*Client)
+
+// WithTimeout sets the deadline of each send to timeout after it starts.
+// A zero timeout means sends do not time out.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithWriteTimeout bounds the time writing a message to a TCP connection may
+// take. It takes precedence over WithTimeout for writes, and has no effect
+// on UDP clients.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		if t, ok := c.net.(*tcp); ok {
+			t.writeTimeout = timeout
+		}
+	}
+}
+
+// WithReadTimeout bounds the time waiting for the response to a message sent
+// over TCP may take, such as the result of a slow query. It takes precedence
+// over WithTimeout for reads, and has no effect on UDP clients.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		if t, ok := c.net.(*tcp); ok {
+			t.readTimeout = timeout
+		}
+	}
+}
+
+// WithDefaultTTL sets the ttl of events sent with a zero Ttl. Events with a
+// positive Ttl keep it, and events with a negative Ttl are sent without any
+// ttl, which Riemann treats as never expiring.
+//
+// Riemann has no default ttl of its own to discover: a configuration may
+// set one with a stream such as (default :ttl 60 (index)), which no query
+// reveals, so align ttl with the configuration of the server.
+func WithDefaultTTL(ttl float32) Option {
+	return func(c *Client) {
+		c.defaultTTL = ttl
+	}
+}
+
+// WithNoDelay disables Nagle's algorithm on TCP connections, so that small
+// writes are sent without delay. Go already disables it on the connections
+// it dials, so this guards against connections configured otherwise. It has
+// no effect on other connections.
+func WithNoDelay() Option {
+	return func(c *Client) {
+		c.noDelay = true
+	}
+}
+
+// WithUDPSendBuffer sets the size in bytes of the operating system's send
+// buffer for UDP connections, so that bursts of events are not dropped
+// before they leave the host. It has no effect on other connections,
+// including UDP relayed through RIEMANN_PROXY.
+//
+// The operating system may clamp the size, e.g. to net.core.wmem_max on
+// Linux; raise that limit (and net.core.rmem_max on the receiving side) for
+// larger buffers to take effect.
+func WithUDPSendBuffer(bytes int) Option {
+	return func(c *Client) {
+		c.udpSendBuffer = bytes
+	}
+}
+
+// WithUDPDescriptionLimit truncates event descriptions longer than limit
+// bytes, ending them with "...", before sending them over UDP, so that events
+// carrying large descriptions such as stack traces still fit in a datagram.
+// Events sent over TCP keep their full description.
+func WithUDPDescriptionLimit(limit int) Option {
+	return func(c *Client) {
+		c.udpDescriptionLimit = limit
+	}
+}
+
+// WithFrameWidth sets the size in bytes, 2 or 4, and the byte order of the
+// length prefix framing messages over TCP, for Riemann-compatible servers
+// that do not use Riemann's 4 byte big endian prefix. It has no effect on
+// UDP clients.
+func WithFrameWidth(width int, order binary.ByteOrder) Option {
+	return func(c *Client) {
+		if t, ok := c.net.(*tcp); ok {
+			t.frameWidth = width
+			t.byteOrder = order
+		}
+	}
+}
+
+// WithValidation makes dialing a TCP Client send an empty message and fail
+// unless Riemann acknowledges it within timeout, so that an address where
+// nothing answers is caught at startup. UDP clients cannot be validated:
+// dialing UDP succeeds whether or not anything listens, and sends to a
+// wrong address are lost silently.
+func WithValidation(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.validateTimeout = timeout
+	}
+}
+
+// WithResolver makes a Client resolve the host of the server address with r
+// instead of the default resolver, e.g. for split-horizon DNS. Through a
+// RIEMANN_PROXY proxy, r resolves the host of the proxy, which resolves the
+// server address itself.
+func WithResolver(r *net.Resolver) Option {
+	return func(c *Client) {
+		c.resolver = r
+	}
+}
+
+// WithEmptyEventError makes a Client fail sends of events with every field
+// zero with ErrEmptyEvent, rather than skipping such events.
+func WithEmptyEventError() Option {
+	return func(c *Client) {
+		c.rejectEmpty = true
+	}
+}
+
+// WithReportTTLMultiplier sets the ttl of the events of the periodic
+// reporters of a Client, such as StartRuntimeMetrics, to multiplier times
+// their reporting interval, so that a single missed report does not expire
+// them. It defaults to 2.5.
+func WithReportTTLMultiplier(multiplier float64) Option {
+	return func(c *Client) {
+		c.reportTTLMultiplier = multiplier
+	}
+}
+
+// WithMetricScale multiplies the metric of the events a Client sends by
+// factor, e.g. 1e-3 to report milliseconds as seconds. Integer metrics stay
+// integers: the scaled value is truncated toward zero, so that a metric of
+// 1500 scaled by 1e-3 is sent as 1. Send float metrics to keep fractions.
+func WithMetricScale(factor float64) Option {
+	return func(c *Client) {
+		c.metricScale = factor
+	}
+}
+
+// WithHostFromConn makes a Client send events with an empty Host with the
+// local IP address its connection was dialed from, i.e. the address traffic
+// to Riemann egresses from, rather than os.Hostname(). The address is read
+// once, at dial time. If it cannot be determined, e.g. behind a proxy that
+// hides it, the hostname is sent as usual.
+func WithHostFromConn() Option {
+	return func(c *Client) {
+		c.hostFromConn = true
+	}
+}
@@ -0,0 +1,42 @@
+package raidman
+
+import "fmt"
+
+// EventError is an event SendEach did not send, and why.
+type EventError struct {
+	Index int // Index of the event in the batch
+	Event *Event
+	Err   error
+}
+
+func (e EventError) Error() string {
+	return fmt.Sprintf("event %d: %v", e.Index, e.Err)
+}
+
+// SendEach validates each of events on its own and sends the valid ones in a
+// single batch, unlike SendMulti, which sends nothing if any event is
+// invalid. It returns how many events were sent, and an error for each one
+// that was not: an invalid event is skipped, and if the batch fails every
+// valid event is reported with the error of the send.
+func (c *Client) SendEach(events []*Event) (sent int, rejected []EventError) {
+	valid := make([]*Event, 0, len(events))
+	indexes := make([]int, 0, len(events))
+	for i, event := range events {
+		if err := event.Validate(); err != nil {
+			rejected = append(rejected, EventError{i, event, err})
+			continue
+		}
+		valid = append(valid, event)
+		indexes = append(indexes, i)
+	}
+	if len(valid) == 0 {
+		return 0, rejected
+	}
+	if err := c.SendMulti(valid); err != nil {
+		for j, event := range valid {
+			rejected = append(rejected, EventError{indexes[j], event, err})
+		}
+		return 0, rejected
+	}
+	return len(valid), rejected
+}
@@ -0,0 +1,86 @@
+package raidman
+
+import (
+	"net"
+	"time"
+
+	"github.com/amir/raidman/proto"
+)
+
+// WithProbe makes a TCP Client send an empty message every interval and
+// reconnect when Riemann does not acknowledge it within interval. This
+// detects half-open connections, where writes still succeed but the server
+// is gone, sooner than TCP keepalive usually does. It has no effect on UDP
+// clients.
+func WithProbe(interval time.Duration) Option {
+	return func(c *Client) {
+		c.probeInterval = interval
+	}
+}
+
+// startProbe starts probing the connection of c if it was configured to.
+func (c *Client) startProbe() {
+	if _, ok := c.net.(*tcp); !ok || c.probeInterval <= 0 {
+		return
+	}
+	c.goBackground(c.probe)
+}
+
+func (c *Client) probe() {
+	ticker := time.NewTicker(c.probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+
+		var err error
+		c.Lock()
+		if c.fallback == nil && !c.idle && c.ping(c.probeInterval) != nil {
+			err = c.reconnect()
+		}
+		c.Unlock()
+		c.backgroundError(err)
+	}
+}
+
+// ping sends an empty message and waits up to timeout for the server to
+// acknowledge it. The caller must hold the lock.
+func (c *Client) ping(timeout time.Duration) error {
+	if err := c.connection.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	if _, err := c.net.Send(&proto.Msg{}, c.connection); err != nil {
+		return err
+	}
+	return c.connection.SetDeadline(time.Time{})
+}
+
+// reconnect replaces the connection of c with a new one. The old connection
+// is kept if dialing fails. The caller must hold the lock.
+func (c *Client) reconnect() error {
+	conn, err := c.redial()
+	if err != nil {
+		return err
+	}
+	c.connection.Close()
+	c.setConnection(conn)
+	return nil
+}
+
+// redial dials a new connection to replace the one of c, calling
+// BeforeReconnect first if set. The caller must hold the lock.
+func (c *Client) redial() (net.Conn, error) {
+	if c.BeforeReconnect != nil {
+		config, err := c.BeforeReconnect()
+		if err != nil {
+			return nil, err
+		}
+		if config != nil {
+			c.tlsConfig = config
+		}
+	}
+	return c.dialNetwork(c.netwrk)
+}
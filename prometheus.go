@@ -0,0 +1,37 @@
+package raidman
+
+// A Sample is a single value of a Prometheus-style metric family: the name of
+// the metric, its labels and its value.
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// NewSampleEvent returns an event for the Prometheus-style metric name with
+// labels and value: name becomes the service, labels the attributes and
+// value the metric. labels is copied.
+func NewSampleEvent(name string, labels map[string]string, value float64) *Event {
+	var attributes map[string]string
+	if len(labels) > 0 {
+		attributes = make(map[string]string, len(labels))
+		for k, v := range labels {
+			attributes[k] = v
+		}
+	}
+	return &Event{
+		Service:    name,
+		Metric:     value,
+		Attributes: attributes,
+	}
+}
+
+// NewSampleEvents returns an event for each of samples, as NewSampleEvent
+// does, e.g. to send a whole scrape with SendMulti.
+func NewSampleEvents(samples []Sample) []*Event {
+	events := make([]*Event, len(samples))
+	for i, s := range samples {
+		events[i] = NewSampleEvent(s.Name, s.Labels, s.Value)
+	}
+	return events
+}
@@ -1,273 +1,444 @@
-// Code generated by protoc-gen-go.
+// Code generated by protoc-gen-go. DO NOT EDIT.
 // source: proto.proto
-// DO NOT EDIT!
 
 package proto
 
-import proto1 "github.com/golang/protobuf/proto"
-import json "encoding/json"
-import math "math"
+import (
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	math "math"
+)
 
-// Reference proto, json, and math imports to suppress error if they are not otherwise used.
-var _ = proto1.Marshal
-var _ = &json.SyntaxError{}
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
 var _ = math.Inf
 
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
 type State struct {
-	Time             *int64   `protobuf:"varint,1,opt,name=time" json:"time,omitempty"`
-	State            *string  `protobuf:"bytes,2,opt,name=state" json:"state,omitempty"`
-	Service          *string  `protobuf:"bytes,3,opt,name=service" json:"service,omitempty"`
-	Host             *string  `protobuf:"bytes,4,opt,name=host" json:"host,omitempty"`
-	Description      *string  `protobuf:"bytes,5,opt,name=description" json:"description,omitempty"`
-	Once             *bool    `protobuf:"varint,6,opt,name=once" json:"once,omitempty"`
-	Tags             []string `protobuf:"bytes,7,rep,name=tags" json:"tags,omitempty"`
-	Ttl              *float32 `protobuf:"fixed32,8,opt,name=ttl" json:"ttl,omitempty"`
-	XXX_unrecognized []byte   `json:"-"`
-}
-
-func (this *State) Reset()         { *this = State{} }
-func (this *State) String() string { return proto1.CompactTextString(this) }
-func (*State) ProtoMessage()       {}
-
-func (this *State) GetTime() int64 {
-	if this != nil && this.Time != nil {
-		return *this.Time
+	Time                 *int64   `protobuf:"varint,1,opt,name=time" json:"time,omitempty"`
+	State                *string  `protobuf:"bytes,2,opt,name=state" json:"state,omitempty"`
+	Service              *string  `protobuf:"bytes,3,opt,name=service" json:"service,omitempty"`
+	Host                 *string  `protobuf:"bytes,4,opt,name=host" json:"host,omitempty"`
+	Description          *string  `protobuf:"bytes,5,opt,name=description" json:"description,omitempty"`
+	Once                 *bool    `protobuf:"varint,6,opt,name=once" json:"once,omitempty"`
+	Tags                 []string `protobuf:"bytes,7,rep,name=tags" json:"tags,omitempty"`
+	Ttl                  *float32 `protobuf:"fixed32,8,opt,name=ttl" json:"ttl,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *State) Reset()         { *m = State{} }
+func (m *State) String() string { return proto.CompactTextString(m) }
+func (*State) ProtoMessage()    {}
+func (*State) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2fcc84b9998d60d8, []int{0}
+}
+
+func (m *State) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_State.Unmarshal(m, b)
+}
+func (m *State) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_State.Marshal(b, m, deterministic)
+}
+func (m *State) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_State.Merge(m, src)
+}
+func (m *State) XXX_Size() int {
+	return xxx_messageInfo_State.Size(m)
+}
+func (m *State) XXX_DiscardUnknown() {
+	xxx_messageInfo_State.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_State proto.InternalMessageInfo
+
+func (m *State) GetTime() int64 {
+	if m != nil && m.Time != nil {
+		return *m.Time
 	}
 	return 0
 }
 
-func (this *State) GetState() string {
-	if this != nil && this.State != nil {
-		return *this.State
+func (m *State) GetState() string {
+	if m != nil && m.State != nil {
+		return *m.State
 	}
 	return ""
 }
 
-func (this *State) GetService() string {
-	if this != nil && this.Service != nil {
-		return *this.Service
+func (m *State) GetService() string {
+	if m != nil && m.Service != nil {
+		return *m.Service
 	}
 	return ""
 }
 
-func (this *State) GetHost() string {
-	if this != nil && this.Host != nil {
-		return *this.Host
+func (m *State) GetHost() string {
+	if m != nil && m.Host != nil {
+		return *m.Host
 	}
 	return ""
 }
 
-func (this *State) GetDescription() string {
-	if this != nil && this.Description != nil {
-		return *this.Description
+func (m *State) GetDescription() string {
+	if m != nil && m.Description != nil {
+		return *m.Description
 	}
 	return ""
 }
 
-func (this *State) GetOnce() bool {
-	if this != nil && this.Once != nil {
-		return *this.Once
+func (m *State) GetOnce() bool {
+	if m != nil && m.Once != nil {
+		return *m.Once
 	}
 	return false
 }
 
-func (this *State) GetTags() []string {
-	if this != nil {
-		return this.Tags
+func (m *State) GetTags() []string {
+	if m != nil {
+		return m.Tags
 	}
 	return nil
 }
 
-func (this *State) GetTtl() float32 {
-	if this != nil && this.Ttl != nil {
-		return *this.Ttl
+func (m *State) GetTtl() float32 {
+	if m != nil && m.Ttl != nil {
+		return *m.Ttl
 	}
 	return 0
 }
 
 type Event struct {
-	Time             *int64       `protobuf:"varint,1,opt,name=time" json:"time,omitempty"`
-	State            *string      `protobuf:"bytes,2,opt,name=state" json:"state,omitempty"`
-	Service          *string      `protobuf:"bytes,3,opt,name=service" json:"service,omitempty"`
-	Host             *string      `protobuf:"bytes,4,opt,name=host" json:"host,omitempty"`
-	Description      *string      `protobuf:"bytes,5,opt,name=description" json:"description,omitempty"`
-	Tags             []string     `protobuf:"bytes,7,rep,name=tags" json:"tags,omitempty"`
-	Ttl              *float32     `protobuf:"fixed32,8,opt,name=ttl" json:"ttl,omitempty"`
-	Attributes       []*Attribute `protobuf:"bytes,9,rep,name=attributes" json:"attributes,omitempty"`
-	MetricSint64     *int64       `protobuf:"zigzag64,13,opt,name=metric_sint64" json:"metric_sint64,omitempty"`
-	MetricD          *float64     `protobuf:"fixed64,14,opt,name=metric_d" json:"metric_d,omitempty"`
-	MetricF          *float32     `protobuf:"fixed32,15,opt,name=metric_f" json:"metric_f,omitempty"`
-	XXX_unrecognized []byte       `json:"-"`
-}
-
-func (this *Event) Reset()         { *this = Event{} }
-func (this *Event) String() string { return proto1.CompactTextString(this) }
-func (*Event) ProtoMessage()       {}
-
-func (this *Event) GetTime() int64 {
-	if this != nil && this.Time != nil {
-		return *this.Time
+	Time                 *int64       `protobuf:"varint,1,opt,name=time" json:"time,omitempty"`
+	State                *string      `protobuf:"bytes,2,opt,name=state" json:"state,omitempty"`
+	Service              *string      `protobuf:"bytes,3,opt,name=service" json:"service,omitempty"`
+	Host                 *string      `protobuf:"bytes,4,opt,name=host" json:"host,omitempty"`
+	Description          *string      `protobuf:"bytes,5,opt,name=description" json:"description,omitempty"`
+	Tags                 []string     `protobuf:"bytes,7,rep,name=tags" json:"tags,omitempty"`
+	Ttl                  *float32     `protobuf:"fixed32,8,opt,name=ttl" json:"ttl,omitempty"`
+	Attributes           []*Attribute `protobuf:"bytes,9,rep,name=attributes" json:"attributes,omitempty"`
+	TimeMicros           *int64       `protobuf:"varint,10,opt,name=time_micros,json=timeMicros" json:"time_micros,omitempty"`
+	MetricSint64         *int64       `protobuf:"zigzag64,13,opt,name=metric_sint64,json=metricSint64" json:"metric_sint64,omitempty"`
+	MetricD              *float64     `protobuf:"fixed64,14,opt,name=metric_d,json=metricD" json:"metric_d,omitempty"`
+	MetricF              *float32     `protobuf:"fixed32,15,opt,name=metric_f,json=metricF" json:"metric_f,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *Event) Reset()         { *m = Event{} }
+func (m *Event) String() string { return proto.CompactTextString(m) }
+func (*Event) ProtoMessage()    {}
+func (*Event) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2fcc84b9998d60d8, []int{1}
+}
+
+func (m *Event) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Event.Unmarshal(m, b)
+}
+func (m *Event) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Event.Marshal(b, m, deterministic)
+}
+func (m *Event) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Event.Merge(m, src)
+}
+func (m *Event) XXX_Size() int {
+	return xxx_messageInfo_Event.Size(m)
+}
+func (m *Event) XXX_DiscardUnknown() {
+	xxx_messageInfo_Event.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Event proto.InternalMessageInfo
+
+func (m *Event) GetTime() int64 {
+	if m != nil && m.Time != nil {
+		return *m.Time
 	}
 	return 0
 }
 
-func (this *Event) GetState() string {
-	if this != nil && this.State != nil {
-		return *this.State
+func (m *Event) GetState() string {
+	if m != nil && m.State != nil {
+		return *m.State
 	}
 	return ""
 }
 
-func (this *Event) GetService() string {
-	if this != nil && this.Service != nil {
-		return *this.Service
+func (m *Event) GetService() string {
+	if m != nil && m.Service != nil {
+		return *m.Service
 	}
 	return ""
 }
 
-func (this *Event) GetHost() string {
-	if this != nil && this.Host != nil {
-		return *this.Host
+func (m *Event) GetHost() string {
+	if m != nil && m.Host != nil {
+		return *m.Host
 	}
 	return ""
 }
 
-func (this *Event) GetDescription() string {
-	if this != nil && this.Description != nil {
-		return *this.Description
+func (m *Event) GetDescription() string {
+	if m != nil && m.Description != nil {
+		return *m.Description
 	}
 	return ""
 }
 
-func (this *Event) GetTags() []string {
-	if this != nil {
-		return this.Tags
+func (m *Event) GetTags() []string {
+	if m != nil {
+		return m.Tags
 	}
 	return nil
 }
 
-func (this *Event) GetTtl() float32 {
-	if this != nil && this.Ttl != nil {
-		return *this.Ttl
+func (m *Event) GetTtl() float32 {
+	if m != nil && m.Ttl != nil {
+		return *m.Ttl
 	}
 	return 0
 }
 
-func (this *Event) GetAttributes() []*Attribute {
-	if this != nil {
-		return this.Attributes
+func (m *Event) GetAttributes() []*Attribute {
+	if m != nil {
+		return m.Attributes
 	}
 	return nil
 }
 
-func (this *Event) GetMetricSint64() int64 {
-	if this != nil && this.MetricSint64 != nil {
-		return *this.MetricSint64
+func (m *Event) GetTimeMicros() int64 {
+	if m != nil && m.TimeMicros != nil {
+		return *m.TimeMicros
+	}
+	return 0
+}
+
+func (m *Event) GetMetricSint64() int64 {
+	if m != nil && m.MetricSint64 != nil {
+		return *m.MetricSint64
 	}
 	return 0
 }
 
-func (this *Event) GetMetricD() float64 {
-	if this != nil && this.MetricD != nil {
-		return *this.MetricD
+func (m *Event) GetMetricD() float64 {
+	if m != nil && m.MetricD != nil {
+		return *m.MetricD
 	}
 	return 0
 }
 
-func (this *Event) GetMetricF() float32 {
-	if this != nil && this.MetricF != nil {
-		return *this.MetricF
+func (m *Event) GetMetricF() float32 {
+	if m != nil && m.MetricF != nil {
+		return *m.MetricF
 	}
 	return 0
 }
 
 type Query struct {
-	String_          *string `protobuf:"bytes,1,opt,name=string" json:"string,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	String_              *string  `protobuf:"bytes,1,opt,name=string" json:"string,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func (this *Query) Reset()         { *this = Query{} }
-func (this *Query) String() string { return proto1.CompactTextString(this) }
-func (*Query) ProtoMessage()       {}
+func (m *Query) Reset()         { *m = Query{} }
+func (m *Query) String() string { return proto.CompactTextString(m) }
+func (*Query) ProtoMessage()    {}
+func (*Query) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2fcc84b9998d60d8, []int{2}
+}
+
+func (m *Query) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Query.Unmarshal(m, b)
+}
+func (m *Query) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Query.Marshal(b, m, deterministic)
+}
+func (m *Query) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Query.Merge(m, src)
+}
+func (m *Query) XXX_Size() int {
+	return xxx_messageInfo_Query.Size(m)
+}
+func (m *Query) XXX_DiscardUnknown() {
+	xxx_messageInfo_Query.DiscardUnknown(m)
+}
 
-func (this *Query) GetString_() string {
-	if this != nil && this.String_ != nil {
-		return *this.String_
+var xxx_messageInfo_Query proto.InternalMessageInfo
+
+func (m *Query) GetString_() string {
+	if m != nil && m.String_ != nil {
+		return *m.String_
 	}
 	return ""
 }
 
 type Msg struct {
-	Ok               *bool    `protobuf:"varint,2,opt,name=ok" json:"ok,omitempty"`
-	Error            *string  `protobuf:"bytes,3,opt,name=error" json:"error,omitempty"`
-	States           []*State `protobuf:"bytes,4,rep,name=states" json:"states,omitempty"`
-	Query            *Query   `protobuf:"bytes,5,opt,name=query" json:"query,omitempty"`
-	Events           []*Event `protobuf:"bytes,6,rep,name=events" json:"events,omitempty"`
-	XXX_unrecognized []byte   `json:"-"`
+	Ok                   *bool    `protobuf:"varint,2,opt,name=ok" json:"ok,omitempty"`
+	Error                *string  `protobuf:"bytes,3,opt,name=error" json:"error,omitempty"`
+	States               []*State `protobuf:"bytes,4,rep,name=states" json:"states,omitempty"`
+	Query                *Query   `protobuf:"bytes,5,opt,name=query" json:"query,omitempty"`
+	Events               []*Event `protobuf:"bytes,6,rep,name=events" json:"events,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func (this *Msg) Reset()         { *this = Msg{} }
-func (this *Msg) String() string { return proto1.CompactTextString(this) }
-func (*Msg) ProtoMessage()       {}
+func (m *Msg) Reset()         { *m = Msg{} }
+func (m *Msg) String() string { return proto.CompactTextString(m) }
+func (*Msg) ProtoMessage()    {}
+func (*Msg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2fcc84b9998d60d8, []int{3}
+}
 
-func (this *Msg) GetOk() bool {
-	if this != nil && this.Ok != nil {
-		return *this.Ok
+func (m *Msg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Msg.Unmarshal(m, b)
+}
+func (m *Msg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Msg.Marshal(b, m, deterministic)
+}
+func (m *Msg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Msg.Merge(m, src)
+}
+func (m *Msg) XXX_Size() int {
+	return xxx_messageInfo_Msg.Size(m)
+}
+func (m *Msg) XXX_DiscardUnknown() {
+	xxx_messageInfo_Msg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Msg proto.InternalMessageInfo
+
+func (m *Msg) GetOk() bool {
+	if m != nil && m.Ok != nil {
+		return *m.Ok
 	}
 	return false
 }
 
-func (this *Msg) GetError() string {
-	if this != nil && this.Error != nil {
-		return *this.Error
+func (m *Msg) GetError() string {
+	if m != nil && m.Error != nil {
+		return *m.Error
 	}
 	return ""
 }
 
-func (this *Msg) GetStates() []*State {
-	if this != nil {
-		return this.States
+func (m *Msg) GetStates() []*State {
+	if m != nil {
+		return m.States
 	}
 	return nil
 }
 
-func (this *Msg) GetQuery() *Query {
-	if this != nil {
-		return this.Query
+func (m *Msg) GetQuery() *Query {
+	if m != nil {
+		return m.Query
 	}
 	return nil
 }
 
-func (this *Msg) GetEvents() []*Event {
-	if this != nil {
-		return this.Events
+func (m *Msg) GetEvents() []*Event {
+	if m != nil {
+		return m.Events
 	}
 	return nil
 }
 
 type Attribute struct {
-	Key              *string `protobuf:"bytes,1,req,name=key" json:"key,omitempty"`
-	Value            *string `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	Key                  *string  `protobuf:"bytes,1,req,name=key" json:"key,omitempty"`
+	Value                *string  `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func (this *Attribute) Reset()         { *this = Attribute{} }
-func (this *Attribute) String() string { return proto1.CompactTextString(this) }
-func (*Attribute) ProtoMessage()       {}
+func (m *Attribute) Reset()         { *m = Attribute{} }
+func (m *Attribute) String() string { return proto.CompactTextString(m) }
+func (*Attribute) ProtoMessage()    {}
+func (*Attribute) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2fcc84b9998d60d8, []int{4}
+}
 
-func (this *Attribute) GetKey() string {
-	if this != nil && this.Key != nil {
-		return *this.Key
+func (m *Attribute) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Attribute.Unmarshal(m, b)
+}
+func (m *Attribute) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Attribute.Marshal(b, m, deterministic)
+}
+func (m *Attribute) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Attribute.Merge(m, src)
+}
+func (m *Attribute) XXX_Size() int {
+	return xxx_messageInfo_Attribute.Size(m)
+}
+func (m *Attribute) XXX_DiscardUnknown() {
+	xxx_messageInfo_Attribute.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Attribute proto.InternalMessageInfo
+
+func (m *Attribute) GetKey() string {
+	if m != nil && m.Key != nil {
+		return *m.Key
 	}
 	return ""
 }
 
-func (this *Attribute) GetValue() string {
-	if this != nil && this.Value != nil {
-		return *this.Value
+func (m *Attribute) GetValue() string {
+	if m != nil && m.Value != nil {
+		return *m.Value
 	}
 	return ""
 }
 
 func init() {
+	proto.RegisterType((*State)(nil), "raidman.State")
+	proto.RegisterType((*Event)(nil), "raidman.Event")
+	proto.RegisterType((*Query)(nil), "raidman.Query")
+	proto.RegisterType((*Msg)(nil), "raidman.Msg")
+	proto.RegisterType((*Attribute)(nil), "raidman.Attribute")
+}
+
+func init() {
+	proto.RegisterFile("proto.proto", fileDescriptor_2fcc84b9998d60d8)
+}
+
+var fileDescriptor_2fcc84b9998d60d8 = []byte{
+	// 446 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xc4, 0x53, 0xc1, 0x8e, 0xd3, 0x30,
+	0x10, 0x95, 0x93, 0xa6, 0x6d, 0xa6, 0x6c, 0x01, 0x0b, 0x21, 0x73, 0x40, 0x6b, 0x05, 0x84, 0x72,
+	0x4a, 0xa5, 0x05, 0x21, 0x71, 0x64, 0x05, 0xdc, 0x56, 0x02, 0xef, 0x8d, 0xcb, 0xca, 0x9b, 0x9a,
+	0xd6, 0xea, 0x26, 0x2e, 0xb6, 0x5b, 0xa9, 0x9f, 0xc3, 0x77, 0xf0, 0x21, 0xfc, 0x0e, 0x9a, 0x89,
+	0xb7, 0xaa, 0xb8, 0x70, 0xdc, 0x4b, 0x34, 0xef, 0x3d, 0x67, 0xfc, 0xe6, 0xd9, 0x86, 0xd9, 0xd6,
+	0xbb, 0xe8, 0x1a, 0xfa, 0xf2, 0x89, 0xd7, 0x76, 0xd9, 0xe9, 0xbe, 0xfa, 0xcd, 0xa0, 0xb8, 0x8e,
+	0x3a, 0x1a, 0xce, 0x61, 0x14, 0x6d, 0x67, 0x04, 0x93, 0xac, 0xce, 0x15, 0xd5, 0xfc, 0x19, 0x14,
+	0x01, 0x45, 0x91, 0x49, 0x56, 0x97, 0x6a, 0x00, 0x5c, 0xc0, 0x24, 0x18, 0xbf, 0xb7, 0xad, 0x11,
+	0x39, 0xf1, 0xf7, 0x10, 0x7b, 0xac, 0x5d, 0x88, 0x62, 0x44, 0x34, 0xd5, 0x5c, 0xc2, 0x6c, 0x69,
+	0x42, 0xeb, 0xed, 0x36, 0x5a, 0xd7, 0x8b, 0x82, 0xa4, 0x53, 0x0a, 0xff, 0x72, 0x7d, 0x6b, 0xc4,
+	0x58, 0xb2, 0x7a, 0xaa, 0xa8, 0x26, 0x37, 0x7a, 0x15, 0xc4, 0x44, 0xe6, 0xd8, 0x09, 0x6b, 0xfe,
+	0x04, 0xf2, 0x18, 0xef, 0xc4, 0x54, 0xb2, 0x3a, 0x53, 0x58, 0x56, 0x7f, 0x32, 0x28, 0x3e, 0xef,
+	0x4d, 0x1f, 0x1f, 0xd6, 0xfd, 0xff, 0x9d, 0xf2, 0x0b, 0x00, 0x1d, 0xa3, 0xb7, 0xb7, 0xbb, 0x68,
+	0x82, 0x28, 0x65, 0x5e, 0xcf, 0x2e, 0x78, 0x93, 0x4e, 0xa1, 0xf9, 0x78, 0x2f, 0xa9, 0x93, 0x55,
+	0xfc, 0x1c, 0x66, 0x38, 0xc7, 0x4d, 0x67, 0x5b, 0xef, 0x82, 0x00, 0x1a, 0x0d, 0x90, 0xba, 0x22,
+	0x86, 0xbf, 0x82, 0xb3, 0xce, 0x44, 0x6f, 0xdb, 0x9b, 0x60, 0xfb, 0xf8, 0xfe, 0x9d, 0x38, 0x93,
+	0xac, 0xe6, 0xea, 0xd1, 0x40, 0x5e, 0x13, 0xc7, 0x5f, 0xc0, 0x34, 0x2d, 0x5a, 0x8a, 0xb9, 0x64,
+	0x35, 0x53, 0x93, 0x01, 0x7f, 0x3a, 0x91, 0x7e, 0x88, 0xc7, 0xe4, 0x35, 0x49, 0x5f, 0xaa, 0x73,
+	0x28, 0xbe, 0xed, 0x8c, 0x3f, 0xf0, 0xe7, 0x30, 0x0e, 0xd1, 0xdb, 0x7e, 0x45, 0xd1, 0x96, 0x2a,
+	0xa1, 0xea, 0x17, 0x83, 0xfc, 0x2a, 0xac, 0xf8, 0x1c, 0x32, 0xb7, 0xa1, 0x84, 0xa7, 0x2a, 0x73,
+	0x1b, 0x0c, 0xdd, 0x78, 0xef, 0x7c, 0x0a, 0x77, 0x00, 0xfc, 0x0d, 0x76, 0xd1, 0x38, 0xfa, 0x88,
+	0x46, 0x9f, 0x1f, 0x47, 0xa7, 0xcb, 0xa7, 0x92, 0xca, 0x5f, 0x43, 0xf1, 0x13, 0xb7, 0xa5, 0xa0,
+	0x4f, 0x97, 0x91, 0x19, 0x35, 0x88, 0xd8, 0xcd, 0xe0, 0xa9, 0x07, 0x31, 0xfe, 0xa7, 0x1b, 0x5d,
+	0x06, 0x95, 0xd4, 0xea, 0x2d, 0x94, 0xc7, 0x64, 0xf1, 0x4c, 0x36, 0xe6, 0x20, 0x98, 0xcc, 0xea,
+	0x52, 0x61, 0x89, 0x56, 0xf7, 0xfa, 0x6e, 0x77, 0xbc, 0x1f, 0x04, 0x2e, 0x3f, 0xc0, 0xd3, 0xd6,
+	0x75, 0x8d, 0xde, 0xae, 0x0f, 0xbe, 0xf1, 0xd6, 0x74, 0xba, 0xef, 0x2f, 0x8b, 0xaf, 0xf8, 0x6c,
+	0xbe, 0xbf, 0x5c, 0xd9, 0xb8, 0xde, 0xdd, 0x36, 0xad, 0xeb, 0x16, 0xba, 0xb3, 0x7e, 0x91, 0xf6,
+	0x5d, 0xd0, 0xab, 0xfa, 0x3b, 0x00, 0xf8, 0xf9, 0xd3, 0x9a, 0x63, 0x03, 0x00, 0x00,
 }
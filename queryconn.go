@@ -0,0 +1,57 @@
+package raidman
+
+import "errors"
+
+// WithSeparateQueryConn makes a Client run its queries over a second
+// connection, dialed with the same options and settings, such as TapWriter
+// and BeforeReconnect, on the first query, rather than over the connection
+// of its sends.
+//
+// Sharing the connection saves a socket, but a query holds it for as long
+// as Riemann takes to answer, during which sends wait, and a send waiting
+// for a slow acknowledgement delays queries likewise. Separate connections
+// keep sends and queries from blocking each other, at the cost of a second
+// socket on both ends. It has no effect over UDP, which does not support
+// queries.
+func WithSeparateQueryConn() Option {
+	return func(c *Client) {
+		c.separateQueries = true
+	}
+}
+
+// queryClient returns the client running the queries of c, dialing it first
+// if needed, or nil if c runs them itself.
+func (c *Client) queryClient() (*Client, error) {
+	if !c.separateQueries {
+		return nil, nil
+	}
+	c.queryMu.Lock()
+	defer c.queryMu.Unlock()
+	if c.queries != nil {
+		return c.queries, nil
+	}
+
+	c.Lock()
+	closed := c.closed
+	c.Unlock()
+	if closed {
+		return nil, errors.New("raidman: client closed")
+	}
+	q, err := DialWithOptions(c.netwrk, c.addr, c.optsWithConfig()...)
+	if err != nil {
+		return nil, err
+	}
+	q.separateQueries = false
+	c.queries = q
+	return q, nil
+}
+
+// closeQueryClient closes the client running the queries of c, if dialed.
+func (c *Client) closeQueryClient() error {
+	c.queryMu.Lock()
+	defer c.queryMu.Unlock()
+	if c.queries == nil {
+		return nil
+	}
+	return c.queries.Close()
+}
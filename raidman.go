@@ -3,49 +3,229 @@ package raidman
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/url"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/amir/raidman/proto"
 	pb "github.com/golang/protobuf/proto"
 	"golang.org/x/net/proxy"
 )
 
+// ErrNilEvent is returned when sending a nil event, or a batch holding only
+// nil events.
+var ErrNilEvent = errors.New("raidman: nil event")
+
+// ErrEmptyEvent is returned when sending an event with every field zero with
+// a Client created with WithEmptyEventError. Other clients skip such events.
+var ErrEmptyEvent = errors.New("raidman: empty event")
+
+// ErrOversize is returned when sending over UDP a message larger than a
+// datagram can carry.
+var ErrOversize = errors.New("raidman: message too large for UDP")
+
+// maxUDPPayload is the largest payload of a UDP datagram over IPv4.
+const maxUDPPayload = 65507
+
 type network interface {
 	Send(message *proto.Msg, conn net.Conn) (*proto.Msg, error)
 }
 
-type tcp struct{}
+type tcp struct {
+	frameWidth   int              // length prefix size in bytes, 4 if zero
+	byteOrder    binary.ByteOrder // length prefix byte order, big endian if nil
+	writeTimeout time.Duration    // bounds writing a message if positive
+	readTimeout  time.Duration    // bounds reading the response if positive
+	codec        Marshaler        // the protobuf library if nil
+
+	// buf holds responses as they are read, reused across messages as
+	// the lock of the Client serializes them.
+	buf []byte
+}
 
-type udp struct{}
+// maxReusedBuffer is the size above which a response buffer is not kept for
+// reuse, so that a single large query result does not pin its memory.
+const maxReusedBuffer = 64 * 1024
+
+type udp struct {
+	codec Marshaler // the protobuf library if nil
+}
 
 // Client represents a connection to a Riemann server
 type Client struct {
 	sync.Mutex
+
+	// OnReject, if set, is called with each event Riemann rejects by
+	// answering ok=false, and the error message of the server, before
+	// the send returns that error. It must be set before c is used.
+	OnReject func(event *Event, reason string)
+
+	// ShouldSend, if set, is called with each event before it is sent,
+	// and the event is dropped if it returns false, e.g. to shed debug
+	// events under load. Stats counts the dropped events. It runs on the
+	// send path, holding up the send, so it must be fast. It must be set
+	// before c is used.
+	ShouldSend func(event *Event) bool
+
+	// TimeOffset is added to the Time and TimeMicros of the events c
+	// sends, to correct a known skew of the local clock, e.g. -2s for a
+	// clock two seconds ahead. Time is corrected to the second. It only
+	// affects outgoing timestamps: events sent without a time are stamped
+	// by Riemann on arrival, and the events of queries are not changed.
+	// It must be set before c is used.
+	TimeOffset time.Duration
+
+	// ContextExtractor, if set, returns attributes to attach to events
+	// sent by c with SendContext, in addition to those of the extractors
+	// registered with RegisterContextExtractor. It must be set before c
+	// is used.
+	ContextExtractor ContextExtractor
+
+	// ServicePrefix, if not empty, is prepended to the service of each
+	// event sent by c, joined by ServiceFormatter, unless the event sets
+	// NoPrefix. It must be set before c is used.
+	ServicePrefix string
+
+	// ServiceFormatter, if set, joins the parts of the service names c
+	// composes, such as ServicePrefix and the service of an event. By
+	// default they are joined with ServiceSeparator. It must be set
+	// before c is used.
+	ServiceFormatter func(parts ...string) string
+
+	// ErrorHandler, if set, is called with the errors of the sends c
+	// makes in the background, such as heartbeats and reconnections of
+	// the probe, which have no caller to return them to. It may be called
+	// from several goroutines at once. It must be set before c is used.
+	ErrorHandler func(err error)
+
+	// BeforeReconnect, if set, is called before c dials a new connection
+	// to replace its own, e.g. to rotate credentials. If it returns an
+	// error, the reconnection is aborted with that error; if it returns a
+	// TLS configuration, the new connection and later ones use it. It must
+	// be set before c is used.
+	BeforeReconnect func() (*tls.Config, error)
+
+	// DryRun, if set, makes c convert, validate and marshal the events it
+	// sends, writing the result to TapWriter, but neither write them to
+	// its connection nor wait for Riemann, so that sends succeed without
+	// exercising the network. Queries are not affected.
+	DryRun bool
+
+	// TapWriter, if set, receives a copy of the bytes c writes to its
+	// connection: the length-prefixed frames of TCP and the datagrams of
+	// UDP, as sent on the wire, not decoded events. Errors writing to it
+	// are ignored. It must be set before c is used.
+	TapWriter io.Writer
+
 	net        network
 	connection net.Conn
 	timeout    time.Duration
+	netwrk     string
+	addr       string
+	opts       []Option
+	tlsConfig  *tls.Config // wraps TCP connections in TLS if not nil
+	closed     bool
+
+	noDelay             bool
+	udpSendBuffer       int
+	udpDescriptionLimit int
+	defaultTTL          float32
+	validateTimeout     time.Duration
+	hostFacts           bool
+	resolver            *net.Resolver
+	rejectEmpty         bool
+	coalesce            *coalescer // nil unless coalescing sends
+	reportTTLMultiplier float64    // defaultReportTTLMultiplier if not positive
+	metricScale         float64    // multiplies metrics if not zero
+	hostFromConn        bool
+	connHost            string // the default host if not empty, from the connection
+
+	separateQueries bool
+	queryMu         sync.Mutex
+	queries         *Client // runs the queries if separateQueries, once dialed
+
+	fallbackAfter   int
+	fallbackRetry   time.Duration
+	fallbackRetried time.Time
+	fallback        net.Conn
+	failures        int
+
+	probeInterval time.Duration
+
+	idleTimeout time.Duration
+	idleTimer   *time.Timer
+	idle        bool // the connection was closed, to be redialed on next use
+	lastUse     time.Time
+
+	stats   clientStats
+	connID  atomic.Uint64     // identifies the connection, read by Stats
+	shed    atomic.Uint64     // events dropped by ShouldSend, read by Stats
+	latency *latencyHistogram // nil unless recording write latencies
+	now     func() time.Time  // time.Now if nil, replaced by tests
+
+	// done is closed by Close to stop the background goroutines of c,
+	// which background tracks.
+	done       chan struct{}
+	background sync.WaitGroup
 }
 
 // An Event represents a single Riemann event
 type Event struct {
-	Ttl         float32           `json:"ttl,omitempty"`
+	Ttl         float32           `json:"ttl,omitempty"` // Zero for the default, negative to never expire
 	Time        int64             `json:"time,omitempty"`
+	TimeMicros  int64             `json:"time_micros,omitempty"` // Takes precedence over Time in Riemann
 	Tags        []string          `json:"tags,omitempty"`
 	Host        string            `json:"host,omitempty"` // Defaults to os.Hostname()
 	State       string            `json:"state,omitempty"`
 	Service     string            `json:"service,omitempty"`
-	Metric      interface{}       `json:"metric,omitempty"` // Could be Int, Float32, Float64
+	Metric      interface{}       `json:"metric,omitempty"` // Could be any integer type, Float32, Float64
 	Description string            `json:"description,omitempty"`
 	Attributes  map[string]string `json:"attributes,omitempty"`
+	NoPrefix    bool              `json:"-"` // Sends Service without the ServicePrefix of the Client
+
+	// ClearMetric sends the event without any metric, whatever Metric
+	// holds. Riemann indexes it in place of the last event of the same
+	// host and service, so that the gauge they carried disappears from
+	// dashboards and is no longer forwarded to metric stores, which skip
+	// events without a metric. A short Ttl then expires it from the index.
+	ClearMetric bool `json:"-"`
+}
+
+// isEmpty reports whether every field of e is zero.
+func (e *Event) isEmpty() bool {
+	s := reflect.ValueOf(e).Elem()
+	for i := 0; i < s.NumField(); i++ {
+		if !isZero(s.Field(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ServiceSeparator joins the parts of the service names a Client composes,
+// unless it has a ServiceFormatter.
+const ServiceSeparator = "."
+
+// serviceName joins parts into a service name with the ServiceFormatter of c,
+// or ServiceSeparator if it has none.
+func (c *Client) serviceName(parts ...string) string {
+	if c.ServiceFormatter != nil {
+		return c.ServiceFormatter(parts...)
+	}
+	return strings.Join(parts, ServiceSeparator)
 }
 
 // Dial establishes a connection to a Riemann server at addr, on the network
@@ -53,36 +233,153 @@ type Event struct {
 //
 // Known networks are "tcp", "tcp4", "tcp6", "udp", "udp4", and "udp6".
 func DialWithTimeout(netwrk, addr string, timeout time.Duration) (c *Client, err error) {
-	c = new(Client)
+	return DialWithOptions(netwrk, addr, WithTimeout(timeout))
+}
+
+// DialWithOptions establishes a connection to a Riemann server at addr, on
+// the network netwrk, configured by opts.
+//
+// Known networks are "tcp", "tcp4", "tcp6", "udp", "udp4", and "udp6".
+func DialWithOptions(netwrk, addr string, opts ...Option) (c *Client, err error) {
+	return dialContext(context.Background(), netwrk, addr, opts...)
+}
+
+// dialContext is DialWithOptions, giving up dialing when ctx is done.
+func dialContext(ctx context.Context, netwrk, addr string, opts ...Option) (c *Client, err error) {
+	c = &Client{done: make(chan struct{})}
 
-	var cnet network
+	cnet, err := newNetwork(netwrk)
+	if err != nil {
+		return nil, fmt.Errorf("dial %q: %v", addr, err)
+	}
+
+	c.net = cnet
+	c.netwrk = netwrk
+	c.addr = addr
+	c.opts = opts
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if t, ok := cnet.(*tcp); ok && t.frameWidth != 0 && t.frameWidth != 2 && t.frameWidth != 4 {
+		return nil, fmt.Errorf("dial %q: unsupported frame width %d", addr, t.frameWidth)
+	}
+
+	if err = c.dialContext(ctx); err != nil {
+		return nil, err
+	}
+	if c.hostFromConn {
+		c.connHost = localIP(c.connection)
+	}
+	if _, ok := cnet.(*tcp); ok && c.validateTimeout > 0 {
+		if err = c.ping(c.validateTimeout); err != nil {
+			c.connection.Close()
+			return nil, fmt.Errorf("dial %q: no answer from Riemann: %v", addr, err)
+		}
+	}
+	c.startProbe()
+	c.startIdleTimer()
+
+	return c, nil
+}
+
+// localIP returns the local IP address of conn, or "" if it has none.
+func localIP(conn net.Conn) string {
+	var ip net.IP
+	switch addr := conn.LocalAddr().(type) {
+	case *net.TCPAddr:
+		ip = addr.IP
+	case *net.UDPAddr:
+		ip = addr.IP
+	}
+	if ip == nil || ip.IsUnspecified() {
+		return ""
+	}
+	return ip.String()
+}
+
+// newNetwork returns the transport for netwrk, one of the known networks.
+func newNetwork(netwrk string) (network, error) {
 	switch netwrk {
 	case "tcp", "tcp4", "tcp6":
-		cnet = new(tcp)
+		return new(tcp), nil
 	case "udp", "udp4", "udp6":
-		cnet = new(udp)
-	default:
-		return nil, fmt.Errorf("dial %q: unsupported network %q", netwrk, netwrk)
+		return new(udp), nil
 	}
+	return nil, fmt.Errorf("unsupported network %q", netwrk)
+}
 
-	dialer, err := newDialer()
+// dialContext connects c to its server, giving up once ctx is done.
+func (c *Client) dialContext(ctx context.Context) error {
+	conn, err := c.dialNetworkContext(ctx, c.netwrk)
+	if err != nil {
+		return err
+	}
+	c.setConnection(conn)
+	return nil
+}
+
+// dialNetwork connects to the server of c over netwrk and applies the socket
+// options c was configured with.
+func (c *Client) dialNetwork(netwrk string) (net.Conn, error) {
+	return c.dialNetworkContext(context.Background(), netwrk)
+}
+
+// dialNetworkContext connects like dialNetwork, giving up once ctx is done,
+// through the proxy and resolver of c if any, and over TLS if configured.
+func (c *Client) dialNetworkContext(ctx context.Context, netwrk string) (net.Conn, error) {
+	var forward proxy.Dialer = proxy.Direct
+	if c.resolver != nil {
+		forward = &net.Dialer{Resolver: c.resolver}
+	}
+	dialer, err := newDialerVia(forward)
 	if err != nil {
 		return nil, err
 	}
 
-	c.net = cnet
-	c.timeout = timeout
-	c.connection, err = dialer.Dial(netwrk, addr)
+	var conn net.Conn
+	if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
+		conn, err = contextDialer.DialContext(ctx, netwrk, c.addr)
+	} else {
+		conn, err = dialer.Dial(netwrk, c.addr)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return c, nil
+	if c.noDelay {
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			if err = tcpConn.SetNoDelay(true); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+	}
+
+	if c.udpSendBuffer > 0 {
+		if udpConn, ok := conn.(*net.UDPConn); ok {
+			if err = udpConn.SetWriteBuffer(c.udpSendBuffer); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+	}
+
+	if c.tlsConfig != nil && strings.HasPrefix(netwrk, "tcp") {
+		return c.handshake(ctx, conn)
+	}
+	return conn, nil
 }
 
 func newDialer() (proxy.Dialer, error) {
+	return newDialerVia(proxy.Direct)
+}
+
+// newDialerVia returns a Dialer creating connections with forward, through
+// the proxy named by RIEMANN_PROXY if set.
+func newDialerVia(forward proxy.Dialer) (proxy.Dialer, error) {
 	var proxyUrl = os.Getenv("RIEMANN_PROXY")
-	var dialer proxy.Dialer = proxy.Direct
+	var dialer proxy.Dialer = forward
 
 	// Get a proxy Dialer that will create the connection on our
 	// behalf via the SOCKS5 proxy.  Specify the authentication
@@ -109,39 +406,163 @@ func Dial(netwrk, addr string) (c *Client, err error) {
 	return DialWithTimeout(netwrk, addr, 0)
 }
 
+// Clone establishes a new connection to the server c is connected to, using
+// the same network, options and exported settings, such as ServicePrefix and
+// ShouldSend, and returns it as an independent Client.
+//
+// The returned Client shares neither its connection nor its lock with c, so
+// each goroutine can own a Clone instead of contending on a single Client.
+func (c *Client) Clone() (*Client, error) {
+	return DialWithOptions(c.netwrk, c.addr, c.optsWithConfig()...)
+}
+
+// optsWithConfig returns the options c was dialed with, followed by one
+// applying the exported settings of c and the TLS configuration it uses now,
+// to dial a Client configured like c.
+func (c *Client) optsWithConfig() []Option {
+	c.Lock()
+	tlsConfig := c.tlsConfig
+	c.Unlock()
+	config := func(d *Client) {
+		d.OnReject = c.OnReject
+		d.ShouldSend = c.ShouldSend
+		d.TimeOffset = c.TimeOffset
+		d.ContextExtractor = c.ContextExtractor
+		d.ServicePrefix = c.ServicePrefix
+		d.ServiceFormatter = c.ServiceFormatter
+		d.ErrorHandler = c.ErrorHandler
+		d.BeforeReconnect = c.BeforeReconnect
+		d.DryRun = c.DryRun
+		d.TapWriter = c.TapWriter
+		d.tlsConfig = tlsConfig
+	}
+	return append(c.opts[:len(c.opts):len(c.opts)], config)
+}
+
 func (network *tcp) Send(message *proto.Msg, conn net.Conn) (*proto.Msg, error) {
-	msg := &proto.Msg{}
-	data, err := pb.Marshal(message)
+	if err := network.write(message, conn); err != nil {
+		return nil, err
+	}
+	return network.read(conn)
+}
+
+// write writes message to conn as a single frame.
+func (network *tcp) write(message *proto.Msg, conn net.Conn) error {
+	header, data, err := network.encode(message)
 	if err != nil {
-		return msg, err
+		return err
 	}
-	b := new(bytes.Buffer)
-	if err = binary.Write(b, binary.BigEndian, uint32(len(data))); err != nil {
-		return msg, err
+	if network.writeTimeout > 0 {
+		if err = conn.SetWriteDeadline(time.Now().Add(network.writeTimeout)); err != nil {
+			return err
+		}
 	}
-	if _, err = conn.Write(b.Bytes()); err != nil {
-		return msg, err
+	if _, err = conn.Write(header); err != nil {
+		return err
 	}
-	if _, err = conn.Write(data); err != nil {
-		return msg, err
+	_, err = conn.Write(data)
+	return err
+}
+
+// encode marshals message into its length prefix and its data.
+func (network *tcp) encode(message *proto.Msg) (header, data []byte, err error) {
+	data, err = marshalerOr(network.codec).Marshal(message)
+	if err != nil {
+		return nil, nil, err
 	}
-	var header uint32
-	if err = binary.Read(conn, binary.BigEndian, &header); err != nil {
-		return msg, err
+	b := new(bytes.Buffer)
+	if err = network.writeLength(b, len(data)); err != nil {
+		return nil, nil, err
 	}
-	response := make([]byte, header)
-	if err = readFully(conn, response); err != nil {
-		return msg, err
+	return b.Bytes(), data, nil
+}
+
+// read reads the response to a message from conn. If the server rejected the
+// message, the response is returned along the error to tell a rejection
+// apart from a transport failure.
+func (network *tcp) read(conn net.Conn) (*proto.Msg, error) {
+	return network.readWithin(conn, network.readTimeout)
+}
+
+// readWithin reads the response to a message from conn like read, waiting
+// for it for timeout if positive rather than for the read timeout.
+func (network *tcp) readWithin(conn net.Conn, timeout time.Duration) (*proto.Msg, error) {
+	if timeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
 	}
-	if err = pb.Unmarshal(response, msg); err != nil {
-		return msg, err
+	msg, err := network.readMsg(conn)
+	if err != nil {
+		return nil, err
 	}
 	if msg.GetOk() != true {
-		return msg, errors.New(msg.GetError())
+		return msg, newServerError(msg.GetError())
 	}
 	return msg, nil
 }
 
+// readMsg reads a single frame from r and decodes the message it holds.
+func (network *tcp) readMsg(r io.Reader) (*proto.Msg, error) {
+	msg := &proto.Msg{}
+	header, err := network.readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	var response []byte
+	if header <= maxReusedBuffer {
+		if cap(network.buf) < int(header) {
+			network.buf = make([]byte, header)
+		}
+		response = network.buf[:header]
+	} else {
+		response = make([]byte, header)
+	}
+	if err = readFully(r, response); err != nil {
+		return nil, err
+	}
+	if err = marshalerOr(network.codec).Unmarshal(response, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (network *tcp) order() binary.ByteOrder {
+	if network.byteOrder == nil {
+		return binary.BigEndian
+	}
+	return network.byteOrder
+}
+
+// writeLength writes the length prefix of a frame of n bytes to w.
+func (network *tcp) writeLength(w io.Writer, n int) error {
+	switch network.frameWidth {
+	case 0, 4:
+		return binary.Write(w, network.order(), uint32(n))
+	case 2:
+		if n > math.MaxUint16 {
+			return fmt.Errorf("message of %d bytes is too long for a 2 byte length prefix", n)
+		}
+		return binary.Write(w, network.order(), uint16(n))
+	}
+	return fmt.Errorf("unsupported frame width %d", network.frameWidth)
+}
+
+// readLength reads the length prefix of a frame from r.
+func (network *tcp) readLength(r io.Reader) (uint32, error) {
+	switch network.frameWidth {
+	case 0, 4:
+		var n uint32
+		err := binary.Read(r, network.order(), &n)
+		return n, err
+	case 2:
+		var n uint16
+		err := binary.Read(r, network.order(), &n)
+		return uint32(n), err
+	}
+	return 0, fmt.Errorf("unsupported frame width %d", network.frameWidth)
+}
+
 func readFully(r io.Reader, p []byte) error {
 	for len(p) > 0 {
 		n, err := r.Read(p)
@@ -154,10 +575,13 @@ func readFully(r io.Reader, p []byte) error {
 }
 
 func (network *udp) Send(message *proto.Msg, conn net.Conn) (*proto.Msg, error) {
-	data, err := pb.Marshal(message)
+	data, err := marshalerOr(network.codec).Marshal(message)
 	if err != nil {
 		return nil, err
 	}
+	if len(data) > maxUDPPayload {
+		return nil, ErrOversize
+	}
 	if _, err = conn.Write(data); err != nil {
 		return nil, err
 	}
@@ -165,6 +589,32 @@ func (network *udp) Send(message *proto.Msg, conn net.Conn) (*proto.Msg, error)
 	return nil, nil
 }
 
+// truncateDescriptions shortens the descriptions of the events of message to
+// at most limit bytes, ending them with an ellipsis. A limit of zero or less
+// leaves them untouched.
+func truncateDescriptions(message *proto.Msg, limit int) {
+	const ellipsis = "..."
+	if limit <= 0 {
+		return
+	}
+	for _, e := range message.Events {
+		d := e.GetDescription()
+		if len(d) <= limit {
+			continue
+		}
+		if limit <= len(ellipsis) {
+			e.Description = pb.String(ellipsis[:limit])
+			continue
+		}
+		n := limit - len(ellipsis)
+		// Do not cut a multi-byte character in half.
+		for n > 0 && !utf8.RuneStart(d[n]) {
+			n--
+		}
+		e.Description = pb.String(d[:n] + ellipsis)
+	}
+}
+
 func isZero(v reflect.Value) bool {
 	switch v.Kind() {
 	case reflect.Map:
@@ -181,10 +631,21 @@ func isZero(v reflect.Value) bool {
 }
 
 func eventToPbEvent(event *Event) (*proto.Event, error) {
+	return eventToPbEventHost(event, "")
+}
+
+// eventToPbEventHost converts event like eventToPbEvent, but sends host instead
+// of os.Hostname() if event has no host and host is not empty, leaving
+// event unchanged.
+func eventToPbEventHost(event *Event, host string) (*proto.Event, error) {
 	var e proto.Event
 
 	if event.Host == "" {
-		event.Host, _ = os.Hostname()
+		if host != "" {
+			e.Host = pb.String(host)
+		} else {
+			event.Host, _ = os.Hostname()
+		}
 	}
 	t := reflect.ValueOf(&e).Elem()
 	s := reflect.ValueOf(event).Elem()
@@ -199,20 +660,31 @@ func eventToPbEvent(event *Event) (*proto.Event, error) {
 				tmp := reflect.ValueOf(pb.String(value.String()))
 				t.FieldByName(name).Set(tmp)
 			case "Ttl":
+				if value.Float() < 0 {
+					continue
+				}
 				tmp := reflect.ValueOf(pb.Float32(float32(value.Float())))
 				t.FieldByName(name).Set(tmp)
-			case "Time":
+			case "Time", "TimeMicros":
 				tmp := reflect.ValueOf(pb.Int64(value.Int()))
 				t.FieldByName(name).Set(tmp)
 			case "Tags":
 				tmp := reflect.ValueOf(value.Interface().([]string))
 				t.FieldByName(name).Set(tmp)
 			case "Metric":
+				if event.ClearMetric {
+					continue
+				}
+				// Integers are always sent as metric_sint64, as
+				// float32 holds them exactly only up to 2^24.
 				switch reflect.TypeOf(f.Interface()).Kind() {
-				case reflect.Int, reflect.Int64:
+				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 					tmp := reflect.ValueOf(pb.Int64(int64(value.Int())))
 					t.FieldByName("MetricSint64").Set(tmp)
-				case reflect.Uint64:
+				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+					if value.Uint() > math.MaxInt64 {
+						return nil, fmt.Errorf("Metric %d overflows int64", value.Uint())
+					}
 					tmp := reflect.ValueOf(pb.Int64(int64(value.Uint())))
 					t.FieldByName("MetricSint64").Set(tmp)
 				case reflect.Float32:
@@ -245,6 +717,42 @@ func eventToPbEvent(event *Event) (*proto.Event, error) {
 	return &e, nil
 }
 
+// MarshalSize returns the size in bytes of event marshaled on its own in a
+// message, as it is sent over UDP, without marshaling it. It returns 0 if
+// event cannot be sent.
+func MarshalSize(event *Event) int {
+	e, err := eventToPbEvent(event)
+	if err != nil {
+		return 0
+	}
+	return pb.Size(&proto.Msg{Events: []*proto.Event{e}})
+}
+
+// EventsToMsg returns the message carrying events, as converted for sending
+// without the defaults of any Client. Nil events are skipped.
+func EventsToMsg(events []*Event) (*proto.Msg, error) {
+	message := &proto.Msg{}
+	for _, event := range events {
+		if event == nil {
+			continue
+		}
+		e, err := eventToPbEvent(event)
+		if err != nil {
+			return nil, err
+		}
+		message.Events = append(message.Events, e)
+	}
+	return message, nil
+}
+
+// MsgToEvents returns the events carried by msg, as Query returns them.
+func MsgToEvents(msg *proto.Msg) []Event {
+	return pbEventsToEvents(msg.GetEvents())
+}
+
+// pbEventsToEvents converts events received from Riemann. Integer metrics
+// read back as int64 and float metrics as float64, whether the server set
+// metric_d or only the deprecated metric_f.
 func pbEventsToEvents(pbEvents []*proto.Event) []Event {
 	var events []Event
 
@@ -256,13 +764,20 @@ func pbEventsToEvents(pbEvents []*proto.Event) []Event {
 			Description: event.GetDescription(),
 			Ttl:         event.GetTtl(),
 			Time:        event.GetTime(),
+			TimeMicros:  event.GetTimeMicros(),
 			Tags:        event.GetTags(),
 		}
-		if event.MetricF != nil {
-			e.Metric = event.GetMetricF()
-		} else if event.MetricD != nil {
+		// Servers may set metric_f alongside the field that actually
+		// carries the value, so it is only used as a last resort and
+		// promoted to float64, the same type metric_d reads back as.
+		switch {
+		case event.MetricSint64 != nil:
+			e.Metric = event.GetMetricSint64()
+		case event.MetricD != nil:
 			e.Metric = event.GetMetricD()
-		} else {
+		case event.MetricF != nil:
+			e.Metric = float64(event.GetMetricF())
+		default:
 			e.Metric = event.GetMetricSint64()
 		}
 		if event.Attributes != nil {
@@ -279,43 +794,404 @@ func pbEventsToEvents(pbEvents []*proto.Event) []Event {
 }
 
 // Send sends an event to Riemann
-func (c *Client) Send(event *Event) error {
-	return c.SendMulti([]*Event{event})
+//
+// Over TCP, a nil error means Riemann acknowledged the event. Over UDP, it
+// only means the datagram was handed to the operating system, which may
+// still drop it, as may the network or the server. If Riemann rejects the
+// event, the error is a *ServerError. Sending a nil event returns
+// ErrNilEvent. opts adjust this send only.
+func (c *Client) Send(event *Event, opts ...SendOption) error {
+	return c.SendMulti([]*Event{event}, opts...)
+}
+
+// SendDeadline sends an event to Riemann like Send, giving up at deadline,
+// an absolute time, rather than after a duration. The timeout of c still
+// applies if it expires first.
+func (c *Client) SendDeadline(event *Event, deadline time.Time) error {
+	return c.sendEvents([]*Event{event}, deadline)
+}
+
+// TrySend sends an event to Riemann like Send, unless another goroutine is
+// using c: it then returns false right away rather than waiting, so that
+// the event can be dropped instead.
+func (c *Client) TrySend(event *Event) (bool, error) {
+	events := []*Event{event}
+	message, err := c.message(events)
+	if err != nil || message == nil {
+		return err == nil, err
+	}
+	if !c.TryLock() {
+		return false, nil
+	}
+	defer c.Unlock()
+	return true, c.sendMessage(events, message, time.Time{})
 }
 
 // SendMulti sends multiple events to Riemann
-func (c *Client) SendMulti(events []*Event) error {
+//
+// Nil events are skipped. If events holds nothing but nil events, it
+// returns ErrNilEvent. Events with every field zero are skipped, or
+// rejected with ErrEmptyEvent, as configured by WithEmptyEventError.
+// opts adjust this send only.
+func (c *Client) SendMulti(events []*Event, opts ...SendOption) error {
+	o := newSendOptions(opts)
+	return c.sendEvents(o.events(events), o.deadline())
+}
+
+// sendEvents sends events to Riemann, giving up at deadline unless it is
+// zero.
+func (c *Client) sendEvents(events []*Event, deadline time.Time) error {
+	message, err := c.message(events)
+	if err != nil || message == nil {
+		return err
+	}
+	return c.sendBuilt(events, message, deadline)
+}
+
+// sendBuilt sends message, built from events by message, giving up at
+// deadline unless it is zero.
+func (c *Client) sendBuilt(events []*Event, message *proto.Msg, deadline time.Time) error {
+	if c.coalesce != nil {
+		return c.sendCoalesced(events, message, deadline)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	return c.sendMessage(events, message, deadline)
+}
+
+// message returns the message carrying events, skipping nil ones, those
+// ShouldSend drops and, unless c rejects them, empty ones. It returns a nil
+// message if events holds nothing but nil and skipped events, some of them
+// skipped.
+func (c *Client) message(events []*Event) (*proto.Msg, error) {
 	message := &proto.Msg{}
 
+	nils, skipped := 0, 0
 	for _, event := range events {
-		e, err := eventToPbEvent(event)
+		if event == nil {
+			nils++
+			continue
+		}
+		if event.isEmpty() {
+			if c.rejectEmpty {
+				return nil, ErrEmptyEvent
+			}
+			skipped++
+			continue
+		}
+		if c.ShouldSend != nil && !c.ShouldSend(event) {
+			c.shed.Add(1)
+			skipped++
+			continue
+		}
+		e, err := c.pbEvent(event)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		message.Events = append(message.Events, e)
 	}
+	if nils > 0 && nils == len(events) {
+		return nil, ErrNilEvent
+	}
+	if skipped > 0 && nils+skipped == len(events) {
+		return nil, nil
+	}
+	return message, nil
+}
+
+// sendMessage sends message, carrying events, giving up at deadline unless
+// it is zero. The caller must hold the lock.
+func (c *Client) sendMessage(events []*Event, message *proto.Msg, deadline time.Time) error {
+	if c.DryRun {
+		return c.dryRun(message)
+	}
+	if err := c.use(); err != nil {
+		c.stats.recordFailure(c.timeNow(), "send", err)
+		return err
+	}
+
+	var response *proto.Msg
+	var err error
+	if c.fallback != nil {
+		err = c.sendFallback(message, deadline)
+	} else if response, err = c.send(message, deadline); err != nil {
+		if response != nil {
+			// The server rejected the events: the connection is fine.
+			c.reject(events, response.GetError())
+		} else if c.fallBack() {
+			err = c.sendFallback(message, deadline)
+		}
+	} else {
+		c.failures = 0
+	}
+	if err != nil {
+		c.stats.recordFailure(c.timeNow(), "send", err)
+		return err
+	}
+
+	c.stats.recordSent(c.timeNow(), len(message.Events))
+	return nil
+}
+
+// reject passes events rejected by the server to OnReject, if set.
+func (c *Client) reject(events []*Event, reason string) {
+	if c.OnReject == nil {
+		return
+	}
+	for _, event := range events {
+		if event != nil {
+			c.OnReject(event, reason)
+		}
+	}
+}
+
+// pbEvent converts event for sending, applying the defaults of c.
+func (c *Client) pbEvent(event *Event) (*proto.Event, error) {
+	e, err := eventToPbEventHost(event, c.connHost)
+	if err != nil {
+		return nil, err
+	}
+	if c.TimeOffset != 0 {
+		if e.Time != nil {
+			e.Time = pb.Int64(*e.Time + int64(c.TimeOffset/time.Second))
+		}
+		if e.TimeMicros != nil {
+			e.TimeMicros = pb.Int64(*e.TimeMicros + c.TimeOffset.Microseconds())
+		}
+	}
+	if event.Ttl == 0 && c.defaultTTL > 0 {
+		e.Ttl = pb.Float32(c.defaultTTL)
+	}
+	if c.ServicePrefix != "" && !event.NoPrefix {
+		e.Service = pb.String(c.serviceName(c.ServicePrefix, event.Service))
+	}
+	if c.metricScale != 0 {
+		scalePbMetric(e, c.metricScale)
+	}
+	if c.hostFacts {
+		addHostFacts(e)
+	}
+	return e, nil
+}
+
+// scalePbMetric multiplies whichever metric of e is set by factor, truncating
+// integer metrics.
+func scalePbMetric(e *proto.Event, factor float64) {
+	switch {
+	case e.MetricSint64 != nil:
+		e.MetricSint64 = pb.Int64(int64(float64(*e.MetricSint64) * factor))
+	case e.MetricD != nil:
+		e.MetricD = pb.Float64(*e.MetricD * factor)
+	case e.MetricF != nil:
+		e.MetricF = pb.Float32(float32(float64(*e.MetricF) * factor))
+	}
+}
+
+// send sends message over the connection of c and returns the response of
+// the server, if any. Unless it is zero, deadline bounds the send along the
+// timeout of c. The caller must hold the lock.
+func (c *Client) send(message *proto.Msg, deadline time.Time) (*proto.Msg, error) {
+	if _, ok := c.net.(*udp); ok {
+		truncateDescriptions(message, c.udpDescriptionLimit)
+	}
+
+	if err := c.setDeadline(c.connection, deadline); err != nil {
+		return nil, err
+	}
+	if !deadline.IsZero() {
+		defer c.connection.SetDeadline(time.Time{})
+	}
+
+	start := time.Now()
+	response, err := c.net.Send(message, c.tapped(c.connection))
+	if c.latency != nil {
+		c.latency.record(time.Since(start))
+	}
+	if err != nil && response == nil {
+		err = c.connError(err)
+	}
+	return response, err
+}
+
+// setDeadline sets the deadline of conn to the earliest of deadline and the
+// timeout of c from now, if either is set.
+func (c *Client) setDeadline(conn net.Conn, deadline time.Time) error {
+	if c.timeout > 0 {
+		if d := time.Now().Add(c.timeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	if deadline.IsZero() {
+		return nil
+	}
+	return conn.SetDeadline(deadline)
+}
+
+// QueryBatch returns the lists of events matched by each of queries, in the
+// same order.
+//
+// A Riemann message carries a single query, so the queries are pipelined
+// instead: all of them are written before reading the responses, which the
+// server sends in order. This saves a round trip per query but not the cost
+// of running them. If a query fails, the error of the first one to fail is
+// returned.
+func (c *Client) QueryBatch(queries []string) ([][]Event, error) {
+	results, err := c.queryBatch(queries)
+	c.stats.recordFailure(c.timeNow(), "query", err)
+	return results, err
+}
+
+func (c *Client) queryBatch(queries []string) ([][]Event, error) {
+	t, ok := c.net.(*tcp)
+	if !ok {
+		return nil, errors.New("Querying over UDP is not supported")
+	}
+	qc, err := c.queryClient()
+	if err != nil {
+		return nil, err
+	}
+	if qc != nil {
+		return qc.queryBatch(queries)
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.fallback != nil {
+		return nil, errors.New("Querying is not supported while falling back to UDP")
+	}
+	if err := c.use(); err != nil {
+		return nil, err
+	}
+
+	for _, q := range queries {
+		message := &proto.Msg{Query: &proto.Query{String_: pb.String(q)}}
+		if err := t.write(message, c.tapped(c.connection)); err != nil {
+			return nil, c.connError(err)
+		}
+	}
+
+	results := make([][]Event, len(queries))
+	var firstErr error
+	for i := range queries {
+		response, err := t.read(c.connection)
+		if response == nil && err != nil {
+			// The connection failed: no other response can be read.
+			return nil, c.connError(err)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		results[i] = pbEventsToEvents(response.GetEvents())
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
 
+// SendMsg sends msg to Riemann as is, such as a message relayed from another
+// client, and returns the response of the server. Over UDP the response is
+// always nil.
+//
+// This is an advanced method: the defaults and options that apply to events
+// sent with Send are not applied to msg.
+func (c *Client) SendMsg(msg *proto.Msg) (*proto.Msg, error) {
 	c.Lock()
 	defer c.Unlock()
+	if err := c.use(); err != nil {
+		return nil, err
+	}
 
 	if c.timeout > 0 {
 		err := c.connection.SetDeadline(time.Now().Add(c.timeout))
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	_, err := c.net.Send(message, c.connection)
+	response, err := c.net.Send(msg, c.tapped(c.connection))
+	if err != nil && response == nil {
+		err = c.connError(err)
+	}
+	return response, err
+}
+
+// Query returns a list of events matched by query
+func (c *Client) Query(q string) ([]Event, error) {
+	events, err := c.QueryRaw(q)
+	if err != nil {
+		return nil, err
+	}
+	return pbEventsToEvents(events), nil
+}
+
+// QueryWithRetry returns a list of events matched by query like Query, but
+// reconnects and retries the query when it fails on a network error, up to
+// attempts times in all. Rejections by the server, such as a malformed
+// query, are returned right away. If every attempt fails, the last error is
+// returned. The query is always attempted at least once.
+func (c *Client) QueryWithRetry(q string, attempts int) ([]Event, error) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if err = c.reconnectQueries(); err != nil {
+				continue
+			}
+		}
+		var events []Event
+		if events, err = c.Query(q); err == nil {
+			return events, nil
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// reconnectQueries replaces the connection queries of c run over.
+func (c *Client) reconnectQueries() error {
+	qc, err := c.queryClient()
 	if err != nil {
 		return err
 	}
+	if qc == nil {
+		qc = c
+	}
+	qc.Lock()
+	defer qc.Unlock()
+	return qc.reconnect()
+}
 
-	return nil
+// QueryCount returns the number of events matched by query. The response is
+// still decoded, but no Event is built for the matched events.
+func (c *Client) QueryCount(q string) (int, error) {
+	events, err := c.QueryRaw(q)
+	if err != nil {
+		return 0, err
+	}
+	return len(events), nil
 }
 
-// Query returns a list of events matched by query
-func (c *Client) Query(q string) ([]Event, error) {
+// QueryRaw returns the events matched by query as decoded from the
+// response, including the fields Event does not model.
+//
+// Riemann answers a query with a single message holding every matched
+// event, however many there are, so the response is one frame.
+//
+// The returned events must be treated as read-only.
+func (c *Client) QueryRaw(q string) ([]*proto.Event, error) {
+	events, err := c.queryRaw(q)
+	c.stats.recordFailure(c.timeNow(), "query", err)
+	return events, err
+}
+
+func (c *Client) queryRaw(q string) ([]*proto.Event, error) {
 	switch c.net.(type) {
 	case *udp:
 		return nil, errors.New("Querying over UDP is not supported")
@@ -324,18 +1200,91 @@ func (c *Client) Query(q string) ([]Event, error) {
 	query.String_ = pb.String(q)
 	message := &proto.Msg{}
 	message.Query = query
+	qc, err := c.queryClient()
+	if err != nil {
+		return nil, err
+	}
+	if qc != nil {
+		return qc.queryRaw(q)
+	}
 	c.Lock()
 	defer c.Unlock()
-	response, err := c.net.Send(message, c.connection)
+	if c.fallback != nil {
+		return nil, errors.New("Querying is not supported while falling back to UDP")
+	}
+	if err := c.use(); err != nil {
+		return nil, err
+	}
+	response, err := c.net.Send(message, c.tapped(c.connection))
 	if err != nil {
+		if response == nil {
+			err = c.connError(err)
+		}
 		return nil, err
 	}
-	return pbEventsToEvents(response.GetEvents()), nil
+	if response == nil {
+		// No response without an error means nothing matched.
+		return nil, nil
+	}
+	// A malformed query is rejected with ok=false: do not mistake it for
+	// an empty result, whatever the transport reported.
+	if !response.GetOk() {
+		return nil, newServerError(response.GetError())
+	}
+	return response.GetEvents(), nil
+}
+
+// Conn returns the connection underlying c, or nil once c is closed, so that
+// socket options the Client does not expose can be tuned.
+//
+// Reading from or writing to the returned connection corrupts the framing of
+// the messages exchanged with Riemann; only use it for configuration.
+func (c *Client) Conn() net.Conn {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil
+	}
+	return c.connection
+}
+
+// CloseContext closes the connection to Riemann like Close, but returns
+// ctx.Err() if ctx is done before closing completes. The connection is then
+// abandoned and finishes closing in the background.
+func (c *Client) CloseContext(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Close()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Close closes the connection to Riemann
+//
+// Close waits for sends in progress to complete first. The Client does not
+// buffer events, so every send that returned before Close has been written
+// to the connection, with the guarantees described for Send.
 func (c *Client) Close() error {
+	c.stopBackground()
+	c.closeQueryClient()
 	c.Lock()
 	defer c.Unlock()
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+	}
+	if c.fallback != nil {
+		c.fallback.Close()
+	}
+	if c.idle {
+		// The connection was already closed, for being idle or after a
+		// failed redial.
+		return nil
+	}
 	return c.connection.Close()
 }
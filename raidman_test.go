@@ -1,10 +1,30 @@
 package raidman
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/amir/raidman/proto"
+	"github.com/amir/raidman/raidmantest"
+	pb "github.com/golang/protobuf/proto"
 )
 
 func TestTCP(t *testing.T) {
@@ -116,6 +136,63 @@ func TestMetricIsInt64(t *testing.T) {
 	}
 }
 
+func TestClone(t *testing.T) {
+	c, err := DialWithTimeout("tcp", "localhost:5555", time.Second)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+
+	clone, err := c.Clone()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer clone.Close()
+
+	if clone.connection == c.connection {
+		t.Error("Clone shares the connection of its parent")
+	}
+	if clone.timeout != c.timeout {
+		t.Errorf("Clone timeout is %v, want %v", clone.timeout, c.timeout)
+	}
+
+	err = clone.Send(&Event{
+		State:   "success",
+		Host:    "raidman",
+		Service: "tcp-clone",
+		Ttl:     1,
+	})
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestCloneConfig(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+	c.ServicePrefix = "team"
+	c.ShouldSend = func(event *Event) bool {
+		return event.Service != "dropped"
+	}
+
+	clone, err := c.Clone()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer clone.Close()
+
+	for _, service := range []string{"dropped", "kept"} {
+		if err = clone.Send(&Event{Service: service}); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	events := s.Events()
+	if len(events) != 1 || events[0].GetService() != "team"+ServiceSeparator+"kept" {
+		t.Errorf("clone sent %v, want only the prefixed kept event", events)
+	}
+}
+
 func TestUDP(t *testing.T) {
 	c, err := Dial("udp", "localhost:5555")
 	if err != nil {
@@ -136,6 +213,50 @@ func TestUDP(t *testing.T) {
 	c.Close()
 }
 
+func TestLargeIntegerMetric(t *testing.T) {
+	for _, metric := range []interface{}{int64(1 << 40), uint64(1 << 40), uint32(1<<32 - 1), int8(-3)} {
+		e, err := eventToPbEvent(&Event{Host: "raidman", Metric: metric})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if e.MetricSint64 == nil || e.MetricF != nil || e.MetricD != nil {
+			t.Errorf("Metric %v (%T) is not sent as metric_sint64: %v", metric, metric, e)
+		}
+		if e.GetMetricSint64() != reflect.ValueOf(metric).Convert(reflect.TypeOf(int64(0))).Int() {
+			t.Errorf("Metric %v is sent as %d", metric, e.GetMetricSint64())
+		}
+	}
+
+	overflow := &Event{Host: "raidman", Metric: uint64(math.MaxInt64) + 1}
+	if _, err := eventToPbEvent(overflow); err == nil {
+		t.Error("No error sending a metric overflowing int64")
+	}
+	if err := overflow.Validate(); err == nil {
+		t.Error("Validate accepts a metric overflowing int64")
+	}
+}
+
+func TestValidateNamedMetric(t *testing.T) {
+	type byteCount int64
+	type ratio float64
+	type big uint64
+	for _, metric := range []interface{}{byteCount(42), ratio(0.5), big(7)} {
+		event := &Event{Host: "raidman", Metric: metric}
+		if err := event.Validate(); err != nil {
+			t.Errorf("Validate rejects metric %#v: %v", metric, err)
+		}
+		if _, err := eventToPbEvent(event); err != nil {
+			t.Errorf("metric %#v is not sent: %v", metric, err)
+		}
+	}
+	if err := (&Event{Metric: big(math.MaxUint64)}).Validate(); err == nil {
+		t.Error("Validate accepts a named metric overflowing int64")
+	}
+	if err := (&Event{Metric: "42"}).Validate(); err == nil {
+		t.Error("Validate accepts a string metric")
+	}
+}
+
 func TestTCPWithoutHost(t *testing.T) {
 	c, err := Dial("tcp", "localhost:5555")
 	if err != nil {
@@ -170,101 +291,3074 @@ func TestTCPWithoutHost(t *testing.T) {
 	}
 }
 
-func TestIsZero(t *testing.T) {
-	event := &Event{
-		Time: 1,
+// dialTestServer starts an in-memory Riemann server and connects to it over
+// netwrk.
+func dialTestServer(t testing.TB, netwrk string) (*raidmantest.Server, *Client) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
 	}
-	elem := reflect.ValueOf(event).Elem()
-	eventType := elem.Type()
-	for i := 0; i < elem.NumField(); i++ {
-		field := elem.Field(i)
-		name := eventType.Field(i).Name
-		if name == "Time" {
-			if isZero(field) {
-				t.Error("Time should not be zero")
-			}
-		} else {
-			if !isZero(field) {
-				t.Errorf("%s should be zero", name)
-			}
+	c, err := Dial(netwrk, s.Addr)
+	if err != nil {
+		s.Close()
+		t.Fatal(err.Error())
+	}
+	return s, c
+}
+
+func TestRateLimitedClientDrop(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	r := NewRateLimitedClient(c, 0.001, 2, Drop)
+	for i := 0; i < 5; i++ {
+		if err := r.Send(&Event{Service: "rate-limited", Metric: i}); err != nil {
+			t.Fatal(err.Error())
 		}
 	}
+
+	if n := len(s.Events()); n != 2 {
+		t.Errorf("%d events sent, want 2", n)
+	}
+	if r.Dropped() != 3 {
+		t.Errorf("%d events dropped, want 3", r.Dropped())
+	}
 }
 
-func TestDialer(t *testing.T) {
-	proxyAddr := "localhost:9999"
-	os.Setenv("RIEMANN_PROXY", "socks5://"+proxyAddr)
-	defer os.Unsetenv("RIEMANN_PROXY")
-	dialer, err := newDialer()
-	if err != nil {
-		t.Error(err.Error())
+func TestRateLimitedClientBlock(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	r := NewRateLimitedClient(c, 50, 1, Block)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := r.Send(&Event{Service: "rate-limited", Metric: i}); err != nil {
+			t.Fatal(err.Error())
+		}
 	}
-	val := reflect.Indirect(reflect.ValueOf(dialer))
-	// this is a horrible hack but proxy.Dialer exports nothing.
-	addr := fmt.Sprintf("%s", val.FieldByName("addr"))
-	if addr != proxyAddr {
-		t.Errorf("RIEMANN_PROXY is set and is %s but dialer's proxy is %s", proxyAddr, addr)
+
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("3 events sent in %v at 50 events per second", elapsed)
+	}
+	if n := len(s.Events()); n != 3 {
+		t.Errorf("%d events sent, want 3", n)
+	}
+	if r.Dropped() != 0 {
+		t.Errorf("%d events dropped with the Block policy", r.Dropped())
 	}
 }
 
-func BenchmarkTCP(b *testing.B) {
-	c, err := Dial("tcp", "localhost:5555")
+func TestRateLimitedClientNoRate(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
 
-	var event = &Event{
-		State:   "good",
-		Host:    "raidman",
-		Service: "benchmark",
+	var r Sender = NewRateLimitedClient(c, 0, 1, Block)
+	for i := 0; i < 3; i++ {
+		if err := r.Send(&Event{Service: "no-rate", Metric: i}); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if n := len(s.Events()); n != 1 {
+		t.Errorf("%d events sent, want 1", n)
 	}
+	if dropped := r.(*RateLimitedClient).Dropped(); dropped != 2 {
+		t.Errorf("%d events dropped, want 2", dropped)
+	}
+}
 
-	if err == nil {
-		for i := 0; i < b.N; i++ {
-			c.Send(event)
+func TestDedupClient(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	d := NewDedupClient(c, 50*time.Millisecond)
+	send := func(state string) {
+		err := d.Send(&Event{Host: "raidman", Service: "dedup", State: state})
+		if err != nil {
+			t.Fatal(err.Error())
 		}
 	}
-	c.Close()
+	send("ok")
+	send("ok")
+	send("critical")
+	time.Sleep(60 * time.Millisecond)
+	send("ok")
+
+	if n := len(s.Events()); n != 3 {
+		t.Errorf("%d events sent, want 3", n)
+	}
+	if d.Suppressed() != 1 {
+		t.Errorf("%d events suppressed, want 1", d.Suppressed())
+	}
 }
 
-func BenchmarkUDP(b *testing.B) {
-	c, err := Dial("udp", "localhost:5555")
+func TestConn(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
 
-	var event = &Event{
-		State:   "good",
-		Host:    "raidman",
-		Service: "benchmark",
+	if _, ok := c.Conn().(*net.TCPConn); !ok {
+		t.Errorf("Conn returned %T, want *net.TCPConn", c.Conn())
+	}
+	c.Close()
+	if c.Conn() != nil {
+		t.Error("Conn is not nil after Close")
 	}
+}
 
-	if err == nil {
-		for i := 0; i < b.N; i++ {
-			c.Send(event)
+func TestWithNoDelay(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	for _, netwrk := range []string{"tcp", "udp"} {
+		c, err := DialWithOptions(netwrk, s.Addr, WithNoDelay())
+		if err != nil {
+			t.Fatalf("%s: %s", netwrk, err.Error())
+		}
+		if err = c.Send(&Event{Service: "no-delay"}); err != nil {
+			t.Errorf("%s: %s", netwrk, err.Error())
 		}
+		c.Close()
+	}
+}
+
+func TestWithValidation(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	c, err := DialWithOptions("tcp", s.Addr, WithValidation(time.Second))
+	if err != nil {
+		t.Fatal(err.Error())
 	}
 	c.Close()
+
+	// A listener that accepts connections but never answers.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+	if _, err = DialWithOptions("tcp", listener.Addr().String(), WithValidation(20*time.Millisecond)); err == nil {
+		t.Error("Dialing a server that does not answer succeeded")
+	}
 }
 
-func BenchmarkConcurrentTCP(b *testing.B) {
-	c, err := Dial("tcp", "localhost:5555")
+// serveLoopbackDNS answers the DNS queries framed over conn as over TCP,
+// resolving every name to 127.0.0.1. Only A queries get an answer.
+func serveLoopbackDNS(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+		query := make([]byte, length)
+		if _, err := io.ReadFull(conn, query); err != nil || len(query) < 12 {
+			return
+		}
+		end := 12
+		for end < len(query) && query[end] != 0 {
+			end += int(query[end]) + 1
+		}
+		question := query[12 : end+5]
+		qtype := binary.BigEndian.Uint16(question[len(question)-4:])
 
-	var event = &Event{
-		Host:    "raidman",
-		Service: "tcp_concurrent",
-		Tags:    []string{"concurrent", "tcp", "benchmark"},
+		response := append([]byte{}, query[:2]...)
+		response = append(response, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0)
+		response = append(response, question...)
+		if qtype == 1 {
+			response[7] = 1
+			response = append(response, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 127, 0, 0, 1)
+		}
+		binary.Write(conn, binary.BigEndian, uint16(len(response)))
+		conn.Write(response)
 	}
+}
 
-	ch := make(chan int, b.N)
-	for i := 0; i < b.N; i++ {
-		go func(metric int) {
-			event.Metric = metric
-			err = c.Send(event)
-			ch <- i
-		}(i)
+func TestWithResolver(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
 	}
-	<-ch
+	defer s.Close()
+	_, port, _ := net.SplitHostPort(s.Addr)
 
-	c.Close()
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go serveLoopbackDNS(server)
+			return client, nil
+		},
+	}
+	c, err := DialWithOptions("tcp", net.JoinHostPort("riemann.invalid", port), WithResolver(resolver))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+	if err = c.Send(&Event{Service: "resolved"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if n := len(s.Events()); n != 1 {
+		t.Errorf("Server received %d events, want 1", n)
+	}
 }
 
-func BenchmarkConcurrentUDP(b *testing.B) {
-	c, err := Dial("udp", "localhost:5555")
+func TestWithUDPSendBuffer(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	for _, netwrk := range []string{"udp", "tcp"} {
+		c, err := DialWithOptions(netwrk, s.Addr, WithUDPSendBuffer(1<<20))
+		if err != nil {
+			t.Fatalf("%s: %s", netwrk, err.Error())
+		}
+		if err = c.Send(&Event{Service: "udp-send-buffer"}); err != nil {
+			t.Errorf("%s: %s", netwrk, err.Error())
+		}
+		c.Close()
+	}
+}
+
+func TestQueryRaw(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	s.SetQueryResponse(&proto.Event{
+		Service:      pb.String("raw"),
+		MetricSint64: pb.Int64(1),
+		MetricF:      pb.Float32(1),
+	})
+	events, err := c.QueryRaw("service = \"raw\"")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(events) != 1 {
+		t.Fatalf("QueryRaw returned %d events, want 1", len(events))
+	}
+	if events[0].GetService() != "raw" || events[0].MetricF == nil || events[0].MetricSint64 == nil {
+		t.Errorf("QueryRaw returned %v", events[0])
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	stop := c.StartHeartbeat("heartbeat", 0.1, 10*time.Millisecond)
+	time.Sleep(35 * time.Millisecond)
+	stop()
+	stop()
+
+	events := s.Events()
+	if len(events) < 2 {
+		t.Fatalf("%d heartbeats sent, want at least 2", len(events))
+	}
+	for _, e := range events {
+		if e.GetService() != "heartbeat" || e.GetState() != "ok" || e.GetTtl() != 0.1 {
+			t.Errorf("Unexpected heartbeat %v", e)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := len(s.Events()); n != len(events) {
+		t.Errorf("%d heartbeats sent after stop", n-len(events))
+	}
+}
+
+func TestRuntimeMetricEvents(t *testing.T) {
+	events := RuntimeMetricEvents([]string{
+		"/gc/cycles/total:gc-cycles",
+		"/sched/latencies:seconds",
+		"/no/such:metric",
+	})
+	var services []string
+	for _, e := range events {
+		services = append(services, e.Service)
+	}
+	expected := []string{
+		"/gc/cycles/total:gc-cycles",
+		"/sched/latencies:seconds.p50",
+		"/sched/latencies:seconds.p90",
+		"/sched/latencies:seconds.p99",
+		"/sched/latencies:seconds.count",
+	}
+	if !reflect.DeepEqual(services, expected) {
+		t.Fatalf("services are %v, want %v", services, expected)
+	}
+	if _, ok := events[0].Metric.(uint64); !ok {
+		t.Errorf("counter metric is %#v, want an integer", events[0].Metric)
+	}
+	if _, ok := events[1].Metric.(float64); !ok {
+		t.Errorf("quantile metric is %#v, want a float", events[1].Metric)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{5, 0, 4, 1},
+		Buckets: []float64{0, 1, 2, 3, math.Inf(1)},
+	}
+	for _, test := range []struct {
+		q, expected float64
+	}{
+		{0.5, 1},
+		{0.6, 3},
+		{0.9, 3},
+		{0.99, 3},
+	} {
+		if v := histogramQuantile(h, 10, test.q); v != test.expected {
+			t.Errorf("quantile %v is %v, want %v", test.q, v, test.expected)
+		}
+	}
+	if v := histogramQuantile(h, 0, 0.5); v != 0 {
+		t.Errorf("quantile of an empty histogram is %v, want 0", v)
+	}
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	stop := c.StartRuntimeMetrics([]string{"/gc/heap/goal:bytes"}, time.Hour)
+	stop()
+	events := s.Events()
+	if len(events) != 1 || events[0].GetService() != "/gc/heap/goal:bytes" || events[0].GetMetricSint64() <= 0 {
+		t.Errorf("runtime metrics sent as %v", events)
+	}
+	if ttl := events[0].GetTtl(); ttl != 9000 {
+		t.Errorf("ttl of runtime metrics reported hourly is %v, want 9000", ttl)
+	}
+
+	c.ServiceFormatter = func(parts ...string) string {
+		return strings.Join(parts, "/")
+	}
+	stop = c.StartRuntimeMetrics([]string{"/sched/latencies:seconds"}, time.Hour)
+	stop()
+	events = s.Events()[1:]
+	if len(events) != 4 || events[0].GetService() != "/sched/latencies:seconds/p50" || events[3].GetService() != "/sched/latencies:seconds/count" {
+		t.Errorf("runtime histogram sent as %v, want services joined by the formatter", events)
+	}
+}
+
+func TestReportTTLMultiplier(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+	c, err := DialWithOptions("tcp", s.Addr, WithReportTTLMultiplier(3))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+
+	stop := c.StartHeartbeat("heartbeat", 0, time.Hour)
+	stop()
+	if events := s.Events(); len(events) != 1 || events[0].GetTtl() != 10800 {
+		t.Errorf("heartbeats sent as %v, want a ttl of 10800", events)
+	}
+}
+
+func TestUDPFallback(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	c, err := DialWithOptions("tcp", s.Addr, WithUDPFallback(1, time.Hour))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+
+	// Break the TCP connection so that the next send fails.
+	c.connection.Close()
+	if err = c.Send(&Event{Service: "fallback"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if c.Mode() != UDPFallback {
+		t.Fatalf("Mode is %v after a failed send, want %v", c.Mode(), UDPFallback)
+	}
+	if _, err = c.Query("true"); err == nil {
+		t.Error("Query succeeded while falling back to UDP")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(s.Events()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(s.Events()); n != 1 {
+		t.Fatalf("%d events received over UDP, want 1", n)
+	}
+
+	c.fallbackRetry = 0
+	if err = c.Send(&Event{Service: "fallback"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if c.Mode() != Normal {
+		t.Errorf("Mode is %v after reconnecting, want %v", c.Mode(), Normal)
+	}
+	if n := len(s.Events()); n != 2 {
+		t.Errorf("%d events received, want 2", n)
+	}
+}
+
+// hangingConn is a connection whose Close blocks until release is closed.
+type hangingConn struct {
+	net.Conn
+	release chan struct{}
+}
+
+func (c *hangingConn) Close() error {
+	<-c.release
+	return c.Conn.Close()
+}
+
+func TestCloseContext(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+
+	conn := &hangingConn{Conn: c.connection, release: make(chan struct{})}
+	defer close(conn.release)
+	c.connection = conn
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.CloseContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("CloseContext returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestTwoByteFrames(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		var length uint16
+		if err := binary.Read(server, binary.LittleEndian, &length); err != nil {
+			return
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(server, data); err != nil {
+			return
+		}
+		msg := &proto.Msg{}
+		if err := pb.Unmarshal(data, msg); err != nil || len(msg.Events) != 1 {
+			return
+		}
+		data, _ = pb.Marshal(&proto.Msg{Ok: pb.Bool(true)})
+		binary.Write(server, binary.LittleEndian, uint16(len(data)))
+		server.Write(data)
+	}()
+
+	c := &Client{
+		net:        &tcp{frameWidth: 2, byteOrder: binary.LittleEndian},
+		connection: client,
+	}
+	client.SetDeadline(time.Now().Add(time.Second))
+	if err := c.Send(&Event{Service: "two-byte-frame"}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	// Accept the message but never answer it.
+	go io.Copy(io.Discard, server)
+
+	c := &Client{
+		net:        &tcp{readTimeout: 20 * time.Millisecond},
+		connection: client,
+	}
+	err := c.Send(&Event{Service: "read-timeout"})
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Errorf("Send returned %v, want a timeout", err)
+	}
+}
+
+func TestDialTLSContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+	// Accept connections but never answer the handshake.
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if _, err = DialTLSContext(ctx, "tcp", listener.Addr().String(), &tls.Config{}); err == nil {
+		t.Error("Dialing with a canceled context succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Dialing with a canceled context took %v", elapsed)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = DialTLSContext(ctx, "tcp", listener.Addr().String(), &tls.Config{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stalled handshake returned %v, want the context deadline", err)
+	}
+
+	if _, err = DialTLSContext(context.Background(), "udp", listener.Addr().String(), &tls.Config{}); err == nil {
+		t.Error("Dialing TLS over UDP succeeded")
+	}
+}
+
+func TestUnsupportedNetwork(t *testing.T) {
+	_, err := Dial("tpc", "localhost:5555")
+	expected := `dial "localhost:5555": unsupported network "tpc"`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Dial returned %v, want %s", err, expected)
+	}
+}
+
+func TestUnsupportedFrameWidth(t *testing.T) {
+	_, err := DialWithOptions("tcp", "localhost:5555", WithFrameWidth(3, binary.BigEndian))
+	if err == nil {
+		t.Error("Dial accepted a 3 byte frame width")
+	}
+}
+
+func TestTruncateDescriptions(t *testing.T) {
+	message := &proto.Msg{Events: []*proto.Event{
+		{Description: pb.String("short")},
+		{Description: pb.String("a long description")},
+		{Description: pb.String("aééééé")},
+		{},
+	}}
+	truncateDescriptions(message, 9)
+
+	expected := []string{"short", "a long...", "aéé...", ""}
+	for i, e := range message.Events {
+		if e.GetDescription() != expected[i] {
+			t.Errorf("Description %d is %q, want %q", i, e.GetDescription(), expected[i])
+		}
+	}
+}
+
+func TestSendRate(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	for i := 0; i < 10; i++ {
+		events := make([]*Event, 5)
+		for j := range events {
+			events[j] = &Event{Service: "send-rate", Metric: j}
+		}
+		if err := c.SendMulti(events); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	// 50 events over a 10 second window.
+	if rate := c.Stats().SendRate; rate < 4 || rate > 6 {
+		t.Errorf("SendRate is %v after sending 50 events, want 5", rate)
+	}
+}
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time { return f.now }
+
+func (f *fakeClock) Advance(d time.Duration) { f.now = f.now.Add(d) }
+
+func TestRateLimitedClientRefill(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+	clock := &fakeClock{time.Unix(1000, 0)}
+	c.now = clock.Now
+
+	r := NewRateLimitedClient(c, 1, 2, Drop)
+	send := func(n int) {
+		for i := 0; i < n; i++ {
+			if err := r.Send(&Event{Service: "refill"}); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+	}
+	send(3)
+	if n := r.Dropped(); n != 1 {
+		t.Errorf("%d events dropped with an empty bucket, want 1", n)
+	}
+	clock.Advance(time.Second)
+	send(2)
+	if n := r.Dropped(); n != 2 {
+		t.Errorf("%d events dropped after refilling a token, want 2", n)
+	}
+	if n := len(s.Events()); n != 3 {
+		t.Errorf("%d events sent, want 3", n)
+	}
+}
+
+func TestSendRateWindow(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+	clock := &fakeClock{time.Unix(1000, 0)}
+	c.now = clock.Now
+
+	send := func(n int) {
+		events := make([]*Event, n)
+		for i := range events {
+			events[i] = &Event{Service: "send-rate"}
+		}
+		if err := c.SendMulti(events); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	send(20)
+	clock.Advance(5 * time.Second)
+	send(30)
+	if rate := c.Stats().SendRate; rate != 5 {
+		t.Errorf("SendRate is %v after sending 50 events, want 5", rate)
+	}
+	clock.Advance(9 * time.Second)
+	if rate := c.Stats().SendRate; rate != 3 {
+		t.Errorf("SendRate is %v once 20 events left the window, want 3", rate)
+	}
+}
+
+func TestRecentErrors(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+	clock := &fakeClock{time.Unix(1000, 0)}
+	c.now = clock.Now
+
+	if err := c.Send(&Event{Service: "recent-errors"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if records := c.RecentErrors(10); len(records) != 0 {
+		t.Fatalf("%d failures recorded after a successful send, want 0", len(records))
+	}
+
+	s.SetError("overloaded")
+	for i := 0; i < 40; i++ {
+		clock.Advance(time.Second)
+		c.Send(&Event{Service: "recent-errors"})
+	}
+	clock.Advance(time.Second)
+	c.Query("true")
+
+	records := c.RecentErrors(100)
+	if len(records) != 32 {
+		t.Fatalf("%d failures recorded, want 32", len(records))
+	}
+	if records[0].Op != "query" || !records[0].Time.Equal(clock.Now()) {
+		t.Errorf("most recent failure is %+v, want the query", records[0])
+	}
+	var serverErr *ServerError
+	if records[1].Op != "send" || !errors.As(records[1].Err, &serverErr) || !serverErr.IsOverloaded() {
+		t.Errorf("second failure is %+v, want an overloaded send", records[1])
+	}
+	if records := c.RecentErrors(2); len(records) != 2 {
+		t.Errorf("%d failures returned, want 2", len(records))
+	}
+}
+
+func TestSeparateQueryConn(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+	s.SetQueryResponse(&proto.Event{Service: pb.String("queried")})
+
+	for _, separate := range []bool{false, true} {
+		var opts []Option
+		if separate {
+			opts = append(opts, WithSeparateQueryConn())
+		}
+		c, err := DialWithOptions("tcp", s.Addr, opts...)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if c.queries != nil {
+			t.Errorf("query connection dialed before the first query")
+		}
+		events, err := c.Query("true")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(events) != 1 || events[0].Service != "queried" {
+			t.Errorf("query returned %v", events)
+		}
+		if (c.queries != nil) != separate {
+			t.Fatalf("separate query connection is %v, want %v", c.queries != nil, separate)
+		}
+		if !separate {
+			c.Close()
+			continue
+		}
+
+		// Queries no longer wait for sends holding the connection.
+		c.Lock()
+		done := make(chan error, 1)
+		go func() {
+			_, err := c.Query("true")
+			done <- err
+		}()
+		select {
+		case err = <-done:
+		case <-time.After(time.Second):
+			t.Error("query waited for the send connection")
+			c.Unlock()
+			err = <-done
+			c.Lock()
+		}
+		c.Unlock()
+		if err != nil {
+			t.Error(err.Error())
+		}
+
+		c.Close()
+		if !c.queries.closed {
+			t.Error("query connection left open by Close")
+		}
+	}
+}
+
+func TestSeparateQueryConnConfig(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	c, err := DialWithOptions("tcp", s.Addr, WithSeparateQueryConn())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+	var tap bytes.Buffer
+	c.TapWriter = &tap
+	calls := 0
+	c.BeforeReconnect = func() (*tls.Config, error) {
+		calls++
+		return nil, nil
+	}
+
+	if _, err = c.Query("true"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if tap.Len() == 0 {
+		t.Error("TapWriter did not see the query")
+	}
+
+	// Break the query connection, for the retry to reconnect it.
+	c.queries.connection.Close()
+	if _, err = c.QueryWithRetry("true", 2); err != nil {
+		t.Fatal(err.Error())
+	}
+	if calls != 1 {
+		t.Errorf("BeforeReconnect was called %d times, want 1", calls)
+	}
+}
+
+func TestSendAwait(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+	if err := c.SendAwait(&Event{Service: "awaited"}, time.Second); err != nil {
+		t.Fatal(err.Error())
+	}
+	if n := len(s.Events()); n != 1 {
+		t.Errorf("%d events sent, want 1", n)
+	}
+
+	// A listener that accepts connections but never answers.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+	silent, err := Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer silent.Close()
+	first := silent.Stats().ConnID
+	if err := silent.SendAwait(&Event{Service: "awaited"}, 20*time.Millisecond); err != ErrAckTimeout {
+		t.Fatalf("SendAwait returned %v, want ErrAckTimeout", err)
+	}
+	if silent.Stats().ConnID == first {
+		t.Error("connection kept after an acknowledgement timeout")
+	}
+}
+
+func TestSendAwaitWriteTimeout(t *testing.T) {
+	// A listener that accepts connections but never reads them.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	c, err := DialWithOptions("tcp", listener.Addr().String(), WithWriteTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+	stalled := <-accepted
+	defer stalled.Close()
+
+	// Large enough to fill the socket buffers on both ends.
+	event := &Event{Service: "awaited", Description: strings.Repeat("x", 32<<20)}
+	err = c.SendAwait(event, time.Second)
+	if err == ErrAckTimeout {
+		t.Fatal("write timeout reported as an acknowledgement timeout")
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("SendAwait returned %v, want a write timeout", err)
+	}
+}
+
+func TestSendAwaitRedialFailure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	addr := listener.Addr().String()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	c, err := Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+	silent := <-accepted
+	defer silent.Close()
+	listener.Close()
+
+	if err = c.SendAwait(&Event{Service: "awaited"}, 20*time.Millisecond); err != ErrAckTimeout {
+		t.Fatalf("SendAwait returned %v, want ErrAckTimeout", err)
+	}
+
+	// Once the server is back, the next send dials it again.
+	if listener, err = net.Listen("tcp", addr); err != nil {
+		t.Skip("address taken again: " + err.Error())
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, err := ReadMsg(conn); err != nil {
+				return
+			}
+			WriteMsg(conn, &proto.Msg{Ok: pb.Bool(true)})
+		}
+	}()
+	if err = c.Send(&Event{Service: "after"}); err != nil {
+		t.Errorf("send after a failed redial returned %v", err)
+	}
+}
+
+func TestSendAwaitFallback(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+	c, err := DialWithOptions("tcp", listener.Addr().String(), WithUDPFallback(1, time.Hour))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+
+	if err = c.SendAwait(&Event{Service: "awaited"}, 20*time.Millisecond); err != ErrAckTimeout {
+		t.Fatalf("SendAwait returned %v, want ErrAckTimeout", err)
+	}
+	if c.Mode() != UDPFallback {
+		t.Errorf("Mode is %v after an acknowledgement timeout, want %v", c.Mode(), UDPFallback)
+	}
+}
+
+func TestSendDeadline(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	start := time.Now()
+	err := c.SendDeadline(&Event{Service: "late"}, start.Add(-time.Second))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("SendDeadline past its deadline returned %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("SendDeadline past its deadline took %v", elapsed)
+	}
+
+	// The deadline is cleared afterwards.
+	if err = c.SendDeadline(&Event{Service: "on time"}, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = c.Send(&Event{Service: "later"}); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestMetricScale(t *testing.T) {
+	c := &Client{metricScale: 1e-3}
+	tests := []struct {
+		metric   interface{}
+		expected interface{}
+	}{
+		{1500, int64(1)},
+		{-1500, int64(-1)},
+		{int64(2000), int64(2)},
+		{1500.0, 1.5},
+		{float32(250), float32(0.25)},
+	}
+	for _, test := range tests {
+		e, err := c.pbEvent(&Event{Service: "scaled", Metric: test.metric})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		var metric interface{}
+		switch {
+		case e.MetricSint64 != nil:
+			metric = e.GetMetricSint64()
+		case e.MetricD != nil:
+			metric = e.GetMetricD()
+		case e.MetricF != nil:
+			metric = e.GetMetricF()
+		}
+		if metric != test.expected {
+			t.Errorf("metric %#v is scaled to %#v, want %#v", test.metric, metric, test.expected)
+		}
+	}
+
+	e, err := c.pbEvent(&Event{Service: "unscaled"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if e.MetricSint64 != nil || e.MetricD != nil || e.MetricF != nil {
+		t.Errorf("event without metric is sent as %v", e)
+	}
+}
+
+func TestShouldSend(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+	c.ShouldSend = func(e *Event) bool {
+		return e.State != "debug"
+	}
+
+	err := c.SendMulti([]*Event{
+		{Service: "shed", State: "debug"},
+		{Service: "kept", State: "critical"},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = c.Send(&Event{Service: "shed", State: "debug"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if events := s.Events(); len(events) != 1 || events[0].GetService() != "kept" {
+		t.Errorf("events sent are %v, want the critical one", events)
+	}
+	if shed := c.Stats().Shed; shed != 2 {
+		t.Errorf("%d events shed, want 2", shed)
+	}
+}
+
+func TestQueryWithRetry(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+	s.SetQueryResponse(&proto.Event{Service: pb.String("queried")})
+
+	c.connection.Close()
+	if _, err := c.QueryWithRetry("true", 1); err == nil {
+		t.Fatal("query over a closed connection succeeded")
+	}
+	events, err := c.QueryWithRetry("true", 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(events) != 1 || events[0].Service != "queried" {
+		t.Errorf("query returned %v", events)
+	}
+	for _, attempts := range []int{0, -1} {
+		events, err = c.QueryWithRetry("true", attempts)
+		if err != nil || len(events) != 1 {
+			t.Errorf("query with %d attempts returned %v, %v", attempts, events, err)
+		}
+	}
+
+	s.SetError("parse error")
+	first := c.Stats().ConnID
+	_, err = c.QueryWithRetry("true", 3)
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) {
+		t.Errorf("rejected query returned %v, want a *ServerError", err)
+	}
+	if c.Stats().ConnID != first {
+		t.Error("reconnected after a rejection")
+	}
+}
+
+func TestHostFromConn(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	for _, netwrk := range []string{"tcp", "udp"} {
+		c, err := DialWithOptions(netwrk, s.Addr, WithHostFromConn())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer c.Close()
+		e, err := c.pbEvent(&Event{Service: "host-from-conn"})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if e.GetHost() != "127.0.0.1" {
+			t.Errorf("host over %s is %q, want 127.0.0.1", netwrk, e.GetHost())
+		}
+		if e, _ = c.pbEvent(&Event{Host: "explicit"}); e.GetHost() != "explicit" {
+			t.Errorf("explicit host is sent as %q", e.GetHost())
+		}
+	}
+
+	// The event is left without host, so that sending it again sends
+	// the local IP again.
+	c, err := DialWithOptions("tcp", s.Addr, WithHostFromConn())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+	event := &Event{Service: "host-from-conn"}
+	for i := 0; i < 2; i++ {
+		if err = c.Send(event); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if event.Host != "" {
+		t.Errorf("event host set to %q by sending it", event.Host)
+	}
+	for _, e := range s.Events() {
+		if e.GetHost() != "127.0.0.1" {
+			t.Errorf("resent event host is %q, want 127.0.0.1", e.GetHost())
+		}
+	}
+
+	pipe, _ := net.Pipe()
+	defer pipe.Close()
+	hostname, _ := os.Hostname()
+	c = &Client{hostFromConn: true, connHost: localIP(pipe)}
+	if e, _ := c.pbEvent(&Event{Service: "host-from-conn"}); e.GetHost() != hostname {
+		t.Errorf("host without a local address is %q, want %q", e.GetHost(), hostname)
+	}
+}
+
+func TestWriteLatency(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	c, err := DialWithOptions("tcp", s.Addr, WithWriteLatency())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+	for i := 0; i < 10; i++ {
+		if err = c.Send(&Event{Service: "latency"}); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	latency := c.Stats().WriteLatency
+	if total := latency.Total(); total != 10 {
+		t.Errorf("%d latencies recorded, want 10", total)
+	}
+	if p99 := latency.Quantile(0.99); p99 <= 0 || p99 > 10*time.Second {
+		t.Errorf("99th percentile is %v", p99)
+	}
+
+	other, plain := dialTestServer(t, "tcp")
+	defer other.Close()
+	defer plain.Close()
+	plain.Send(&Event{Service: "latency"})
+	if latency := plain.Stats().WriteLatency; latency.Total() != 0 || latency.Counts != nil {
+		t.Errorf("latencies recorded without WithWriteLatency: %v", latency)
+	}
+}
+
+func TestLatencyHistogramQuantile(t *testing.T) {
+	h := LatencyHistogram{
+		Bounds: []time.Duration{time.Millisecond, 10 * time.Millisecond},
+		Counts: []uint64{90, 9, 1},
+	}
+	for _, test := range []struct {
+		q        float64
+		expected time.Duration
+	}{
+		{0.5, time.Millisecond},
+		{0.9, time.Millisecond},
+		{0.99, 10 * time.Millisecond},
+		{1, 10 * time.Millisecond},
+	} {
+		if d := h.Quantile(test.q); d != test.expected {
+			t.Errorf("quantile %v is %v, want %v", test.q, d, test.expected)
+		}
+	}
+	if d := (LatencyHistogram{}).Quantile(0.5); d != 0 {
+		t.Errorf("quantile of an empty histogram is %v", d)
+	}
+}
+
+func TestTimeOffset(t *testing.T) {
+	for _, test := range []struct {
+		offset     time.Duration
+		time       int64
+		timeMicros int64
+	}{
+		{2500 * time.Millisecond, 1002, 1000002500000},
+		{-2500 * time.Millisecond, 998, 999997500000},
+	} {
+		c := &Client{TimeOffset: test.offset}
+		e, err := c.pbEvent(&Event{Service: "skewed", Time: 1000})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if e.GetTime() != test.time {
+			t.Errorf("time with an offset of %v is %d, want %d", test.offset, e.GetTime(), test.time)
+		}
+		if e, _ = c.pbEvent(&Event{Service: "skewed", TimeMicros: 1000000000000}); e.GetTimeMicros() != test.timeMicros {
+			t.Errorf("time_micros with an offset of %v is %d, want %d", test.offset, e.GetTimeMicros(), test.timeMicros)
+		}
+		if e, _ = c.pbEvent(&Event{Service: "unstamped"}); e.Time != nil || e.TimeMicros != nil {
+			t.Errorf("event without a time is sent as %v", e)
+		}
+	}
+}
+
+func TestEventsToMsg(t *testing.T) {
+	message, err := EventsToMsg(nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if message == nil || len(message.Events) != 0 {
+		t.Errorf("message of no events is %v", message)
+	}
+	if events := MsgToEvents(message); len(events) != 0 {
+		t.Errorf("events of an empty message are %v", events)
+	}
+
+	events := []*Event{
+		{Host: "raidman", Service: "first", Metric: int64(1)},
+		nil,
+		{Host: "raidman", Service: "second", Metric: 2.5, Tags: []string{"t"}},
+	}
+	if message, err = EventsToMsg(events); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(message.Events) != 2 {
+		t.Fatalf("message carries %d events, want 2", len(message.Events))
+	}
+	read := MsgToEvents(message)
+	if !reflect.DeepEqual(read, []Event{*events[0], *events[2]}) {
+		t.Errorf("events read back as %v", read)
+	}
+
+	if _, err = EventsToMsg([]*Event{{Metric: "invalid"}}); err == nil {
+		t.Error("message of an event with an invalid metric built")
+	}
+}
+
+func TestReadWriteMsg(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	sent := &proto.Msg{Events: []*proto.Event{{Service: pb.String("framed"), MetricSint64: pb.Int64(42)}}}
+	go WriteMsg(client, sent)
+	received, err := ReadMsg(server)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !pb.Equal(received, sent) {
+		t.Errorf("received %v, want %v", received, sent)
+	}
+
+	// A rejection is a message like any other.
+	rejection := &proto.Msg{Ok: pb.Bool(false), Error: pb.String("no")}
+	go WriteMsg(server, rejection)
+	received, err = ReadMsg(client)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if received.GetError() != "no" {
+		t.Errorf("received %v, want %v", received, rejection)
+	}
+
+	// The framing is the one of the client.
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+	if err = WriteMsg(c.connection, sent); err != nil {
+		t.Fatal(err.Error())
+	}
+	if received, err = ReadMsg(c.connection); err != nil || !received.GetOk() {
+		t.Errorf("server answered %v, %v", received, err)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	var b bytes.Buffer
+	var sink Sender = NewFileSink(&b)
+	events := []*Event{
+		{Host: "raidman", Service: "file", Metric: 42, Tags: []string{"a"}},
+		nil,
+		{Host: "raidman", Service: "file", Metric: 1.5, Attributes: map[string]string{"k": "v"}, Ttl: 10},
+	}
+	if err := sink.SendMulti(events, WithExtraTag("replayed")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := sink.Send(&Event{Service: "file", State: "ok"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if lines := strings.Count(b.String(), "\n"); lines != 3 {
+		t.Errorf("%d lines written, want 3", lines)
+	}
+
+	read, err := UnmarshalEvents(&b)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []*Event{
+		{Host: "raidman", Service: "file", Metric: int64(42), Tags: []string{"a", "replayed"}},
+		{Host: "raidman", Service: "file", Metric: 1.5, Attributes: map[string]string{"k": "v"}, Ttl: 10, Tags: []string{"replayed"}},
+		{Service: "file", State: "ok"},
+	}
+	if !reflect.DeepEqual(read, expected) {
+		t.Errorf("events read back as %v, want %v", read, expected)
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+	clock := &fakeClock{time.Unix(1000, 0)}
+	c.now = clock.Now
+
+	d := NewDedupClient(c, time.Minute)
+	for _, advance := range []time.Duration{0, 59 * time.Second, time.Second} {
+		clock.Advance(advance)
+		if err := d.Send(&Event{Host: "raidman", Service: "dedup"}); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if n := len(s.Events()); n != 2 {
+		t.Errorf("%d events sent, want 2", n)
+	}
+}
+
+func TestTtl(t *testing.T) {
+	tests := []struct {
+		ttl        float32
+		defaultTTL float32
+		expected   float32 // zero if no ttl should be sent
+	}{
+		{0, 0, 0},
+		{0, 30, 30},
+		{-1, 0, 0},
+		{-1, 30, 0},
+		{10, 0, 10},
+		{10, 30, 10},
+	}
+	for _, test := range tests {
+		c := &Client{defaultTTL: test.defaultTTL}
+		e, err := c.pbEvent(&Event{Host: "raidman", Ttl: test.ttl})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if (e.Ttl != nil) != (test.expected != 0) || e.GetTtl() != test.expected {
+			t.Errorf("Ttl %v with default %v is sent as %v, want %v",
+				test.ttl, test.defaultTTL, e.GetTtl(), test.expected)
+		}
+	}
+}
+
+func TestServicePrefix(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		event    Event
+		expected string
+	}{
+		{"", Event{Service: "metric"}, "metric"},
+		{"teamA.subsystem", Event{Service: "metric"}, "teamA.subsystem.metric"},
+		{"teamA.subsystem", Event{Service: "metric", NoPrefix: true}, "metric"},
+	}
+	for _, test := range tests {
+		c := &Client{ServicePrefix: test.prefix}
+		test.event.Host = "raidman"
+		e, err := c.pbEvent(&test.event)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if e.GetService() != test.expected {
+			t.Errorf("Service %q with prefix %q is sent as %q, want %q",
+				test.event.Service, test.prefix, e.GetService(), test.expected)
+		}
+	}
+}
+
+func TestSendEach(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	events := []*Event{
+		{Service: "good", Metric: 1},
+		{Service: "bad", Metric: "1"},
+		{Service: "good", Metric: 2.5},
+	}
+	sent, rejected := c.SendEach(events)
+	if sent != 2 {
+		t.Errorf("%d events sent, want 2", sent)
+	}
+	if len(rejected) != 1 || rejected[0].Index != 1 || rejected[0].Event != events[1] {
+		t.Fatalf("Rejected %v, want the second event", rejected)
+	}
+	if n := len(s.Events()); n != 2 {
+		t.Errorf("Server received %d events, want 2", n)
+	}
+
+	s.SetError("no")
+	sent, rejected = c.SendEach(events)
+	if sent != 0 || len(rejected) != 3 {
+		t.Errorf("Sent %d and rejected %d events when the server errors, want 0 and 3",
+			sent, len(rejected))
+	}
+}
+
+func TestMarshalSize(t *testing.T) {
+	events := []*Event{
+		{Host: "raidman"},
+		{Host: "raidman", Service: "size", Metric: 42, Tags: []string{"a", "b"}},
+		{Host: "raidman", Description: strings.Repeat("x", 1000), Attributes: map[string]string{"k": "v"}},
+	}
+	for _, event := range events {
+		e, err := eventToPbEvent(event)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		data, err := pb.Marshal(&proto.Msg{Events: []*proto.Event{e}})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if size := MarshalSize(event); size != len(data) {
+			t.Errorf("MarshalSize is %d, want %d", size, len(data))
+		}
+	}
+	if size := MarshalSize(&Event{Host: "raidman", Metric: "x"}); size != 0 {
+		t.Errorf("MarshalSize of an invalid event is %d, want 0", size)
+	}
+}
+
+func TestTapWriter(t *testing.T) {
+	for _, netwrk := range []string{"tcp", "udp"} {
+		s, c := dialTestServer(t, netwrk)
+		var tap bytes.Buffer
+		c.TapWriter = &tap
+
+		event := &Event{Host: "raidman", Service: "tap"}
+		if err := c.Send(event); err != nil {
+			t.Fatal(err.Error())
+		}
+		e, _ := eventToPbEvent(event)
+		data, _ := pb.Marshal(&proto.Msg{Events: []*proto.Event{e}})
+		expected := data
+		if netwrk == "tcp" {
+			expected = make([]byte, 4, 4+len(data))
+			binary.BigEndian.PutUint32(expected, uint32(len(data)))
+			expected = append(expected, data...)
+		}
+		if !bytes.Equal(tap.Bytes(), expected) {
+			t.Errorf("%s tap received %x, want %x", netwrk, tap.Bytes(), expected)
+		}
+		c.Close()
+		s.Close()
+	}
+}
+
+func TestSendNil(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	if err := c.Send(nil); err != ErrNilEvent {
+		t.Errorf("Sending nil returned %v, want ErrNilEvent", err)
+	}
+	if err := c.SendMulti([]*Event{nil, nil}); err != ErrNilEvent {
+		t.Errorf("Sending only nils returned %v, want ErrNilEvent", err)
+	}
+	if err := c.SendMulti([]*Event{nil, {Service: "not nil"}, nil}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if n := len(s.Events()); n != 1 {
+		t.Errorf("Server received %d events, want 1", n)
+	}
+}
+
+func TestServiceFormatter(t *testing.T) {
+	c := &Client{
+		ServicePrefix: "teamA",
+		ServiceFormatter: func(parts ...string) string {
+			return strings.Join(parts, "/")
+		},
+	}
+	e, err := c.pbEvent(&Event{Host: "raidman", Service: "metric"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if e.GetService() != "teamA/metric" {
+		t.Errorf("Service is sent as %q, want %q", e.GetService(), "teamA/metric")
+	}
+}
+
+// faultyMarshaler fails to marshal messages while fail is set.
+type faultyMarshaler struct {
+	protoMarshaler
+	fail bool
+}
+
+func (m *faultyMarshaler) Marshal(msg *proto.Msg) ([]byte, error) {
+	if m.fail {
+		return nil, errors.New("injected fault")
+	}
+	return m.protoMarshaler.Marshal(msg)
+}
+
+func TestMarshaler(t *testing.T) {
+	for _, netwrk := range []string{"tcp", "udp"} {
+		s, err := raidmantest.NewServer()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		m := &faultyMarshaler{}
+		c, err := DialWithOptions(netwrk, s.Addr, WithMarshaler(m))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if err = c.Send(&Event{Service: "marshaler"}); err != nil {
+			t.Errorf("%s: %v", netwrk, err)
+		}
+		m.fail = true
+		if err = c.Send(&Event{Service: "marshaler"}); err == nil || err.Error() != "injected fault" {
+			t.Errorf("%s: Send returned %v, want the injected fault", netwrk, err)
+		}
+		c.Close()
+		s.Close()
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	var tap bytes.Buffer
+	c := &Client{
+		net:        new(tcp),
+		connection: client,
+		DryRun:     true,
+		TapWriter:  &tap,
+	}
+	// Nothing reads the pipe, so any write to it would block.
+	if err := c.Send(&Event{Host: "raidman", Service: "dry-run"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if tap.Len() == 0 {
+		t.Error("Nothing was written to the tap")
+	}
+	if err := c.Send(&Event{Host: "raidman", Metric: "invalid"}); err == nil {
+		t.Error("Dry run accepted an invalid event")
+	}
+}
+
+func TestSendOptions(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	event := &Event{Service: "options", Tags: []string{"web"}}
+	if err := c.Send(event, WithExtraTag("incident"), WithSendTimeout(time.Second)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := c.Send(event); err != nil {
+		t.Fatal(err.Error())
+	}
+	events := s.Events()
+	if len(events) != 2 {
+		t.Fatalf("%d events sent, want 2", len(events))
+	}
+	if tags := events[0].GetTags(); !reflect.DeepEqual(tags, []string{"web", "incident"}) {
+		t.Errorf("Tags sent with WithExtraTag are %v", tags)
+	}
+	if tags := events[1].GetTags(); !reflect.DeepEqual(tags, []string{"web"}) {
+		t.Errorf("Tags of the next send are %v", tags)
+	}
+	if !reflect.DeepEqual(event.Tags, []string{"web"}) {
+		t.Errorf("WithExtraTag changed the event to %v", event.Tags)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go io.Copy(io.Discard, server)
+	c = &Client{net: new(tcp), connection: client}
+	err := c.Send(&Event{Service: "options"}, WithSendTimeout(20*time.Millisecond))
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Errorf("Send returned %v, want a timeout", err)
+	}
+}
+
+func TestTrySend(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	sent, err := c.TrySend(&Event{Service: "try"})
+	if !sent || err != nil {
+		t.Fatalf("TrySend returned %v, %v on an idle client", sent, err)
+	}
+
+	c.Lock()
+	sent, err = c.TrySend(&Event{Service: "try"})
+	c.Unlock()
+	if sent || err != nil {
+		t.Errorf("TrySend returned %v, %v on a busy client, want false, nil", sent, err)
+	}
+	if n := len(s.Events()); n != 1 {
+		t.Errorf("%d events sent, want 1", n)
+	}
+}
+
+func TestHostFacts(t *testing.T) {
+	c := &Client{hostFacts: true}
+	e, err := c.pbEvent(&Event{Host: "raidman", Attributes: map[string]string{"os": "custom"}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	attributes := make(map[string]string)
+	for _, attr := range e.GetAttributes() {
+		if _, ok := attributes[attr.GetKey()]; ok {
+			t.Errorf("Attribute %q is sent twice", attr.GetKey())
+		}
+		attributes[attr.GetKey()] = attr.GetValue()
+	}
+	if attributes["os"] != "custom" {
+		t.Errorf("os is %q, want the attribute of the event", attributes["os"])
+	}
+	if attributes["arch"] != runtime.GOARCH {
+		t.Errorf("arch is %q, want %q", attributes["arch"], runtime.GOARCH)
+	}
+}
+
+func TestOsReleaseName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "os-release")
+	data := "NAME=\"Debian GNU/Linux\"\nPRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nID=debian\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if name := osReleaseName(path); name != "Debian GNU/Linux 12 (bookworm)" {
+		t.Errorf("osReleaseName is %q", name)
+	}
+	if name := osReleaseName(path + ".missing"); name != "" {
+		t.Errorf("osReleaseName of a missing file is %q", name)
+	}
+}
+
+func TestCoalescing(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	c, err := DialWithOptions("tcp", s.Addr, WithCoalescing())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+	var tap bytes.Buffer
+	c.TapWriter = &tap
+
+	// Hold the connection until every send is queued, so that they are
+	// all coalesced.
+	c.Lock()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := c.Send(&Event{Service: "coalesced", Metric: i}); err != nil {
+				t.Error(err.Error())
+			}
+		}(i)
+	}
+	for queued := 0; queued < 50; time.Sleep(time.Millisecond) {
+		c.coalesce.mu.Lock()
+		queued = len(c.coalesce.pending)
+		c.coalesce.mu.Unlock()
+	}
+	c.Unlock()
+	wg.Wait()
+	if n := len(s.Events()); n != 50 {
+		t.Errorf("Server received %d events, want 50", n)
+	}
+	frames := 0
+	for tap.Len() > 0 {
+		if _, err = new(tcp).readMsg(&tap); err != nil {
+			t.Fatal(err.Error())
+		}
+		frames++
+	}
+	if frames != 1 {
+		t.Errorf("%d messages sent for 50 concurrent sends, want 1", frames)
+	}
+
+	s.SetError("no")
+	if err = c.Send(&Event{Service: "coalesced"}); err == nil {
+		t.Error("A rejected coalesced send succeeded")
+	}
+}
+
+func TestSendEmpty(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	if err := c.Send(&Event{}); err != nil {
+		t.Errorf("Sending an empty event returned %v", err)
+	}
+	if err := c.SendMulti([]*Event{{}, {Service: "not empty"}, {Tags: []string{}}}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if n := len(s.Events()); n != 1 {
+		t.Errorf("Server received %d events, want 1", n)
+	}
+
+	strict, err := DialWithOptions("tcp", s.Addr, WithEmptyEventError())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer strict.Close()
+	if err = strict.Send(&Event{}); err != ErrEmptyEvent {
+		t.Errorf("Sending an empty event returned %v, want ErrEmptyEvent", err)
+	}
+}
+
+func TestSendMsg(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	response, err := c.SendMsg(&proto.Msg{
+		Events: []*proto.Event{{Service: pb.String("relayed")}},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !response.GetOk() {
+		t.Errorf("SendMsg returned %v, want an ok response", response)
+	}
+
+	events := s.Events()
+	if len(events) != 1 || events[0].GetService() != "relayed" || events[0].Host != nil {
+		t.Errorf("Server received %v, want the relayed event as is", events)
+	}
+}
+
+func TestProbeReconnects(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	c, err := DialWithOptions("tcp", s.Addr, WithProbe(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+
+	// Swap in a half-open connection: writes succeed but nothing answers.
+	client, server := net.Pipe()
+	defer server.Close()
+	go io.Copy(io.Discard, server)
+	c.Lock()
+	halfOpen := c.connection
+	c.connection = client
+	c.Unlock()
+	halfOpen.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for c.Conn() == client && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if c.Conn() == client {
+		t.Fatal("Probe did not replace the half-open connection")
+	}
+	if err = c.Send(&Event{Service: "probe"}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	errs := make(chan error, 10)
+	c.ErrorHandler = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	s.SetError("overloaded")
+	stop := c.StartHeartbeat("heartbeat", 1, 10*time.Millisecond)
+	defer stop()
+
+	select {
+	case err := <-errs:
+		if err.Error() != "overloaded" {
+			t.Errorf("ErrorHandler received %v, want the error of the server", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("ErrorHandler was not called for a failed heartbeat")
+	}
+}
+
+func TestCloseStopsGoroutines(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	before := runtime.NumGoroutine()
+	c, err := DialWithOptions("tcp", s.Addr, WithProbe(10*time.Millisecond),
+		WithIdleTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.StartHeartbeat("heartbeat", 1, 10*time.Millisecond)
+	time.Sleep(25 * time.Millisecond)
+	if err = c.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// The server notices the closed connection asynchronously.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines left running after Close", n-before)
+	}
+
+	stop := c.StartHeartbeat("heartbeat", 1, 10*time.Millisecond)
+	stop()
+}
+
+func TestBeforeReconnect(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	c, err := DialWithOptions("tcp", s.Addr, WithIdleTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+	calls := 0
+	refreshErr := errors.New("no credentials")
+	c.BeforeReconnect = func() (*tls.Config, error) {
+		calls++
+		return nil, refreshErr
+	}
+
+	// Wait for the connection to be closed for being idle.
+	time.Sleep(30 * time.Millisecond)
+	if err = c.Send(&Event{Service: "reconnect"}); err != refreshErr {
+		t.Errorf("Send returned %v, want the error of BeforeReconnect", err)
+	}
+	c.BeforeReconnect = func() (*tls.Config, error) {
+		calls++
+		return nil, nil
+	}
+	if err = c.Send(&Event{Service: "reconnect"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if calls != 2 {
+		t.Errorf("BeforeReconnect was called %d times, want 2", calls)
+	}
+}
+
+func TestConnID(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	c, err := DialWithOptions("tcp", s.Addr, WithIdleTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+	first := c.Stats().ConnID
+	if first == 0 {
+		t.Fatal("No ConnID after dialing")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err = c.Send(&Event{Service: "conn-id"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	second := c.Stats().ConnID
+	if second == first {
+		t.Error("ConnID did not change on reconnect")
+	}
+
+	c.Lock()
+	c.connection.Close()
+	c.Unlock()
+	err = c.Send(&Event{Service: "conn-id"})
+	if err == nil || !strings.HasPrefix(err.Error(), fmt.Sprintf("connection %d: ", second)) {
+		t.Errorf("Send on a closed connection returned %v, want it to name connection %d", err, second)
+	}
+}
+
+func TestMetricDuration(t *testing.T) {
+	for _, d := range []time.Duration{
+		1500 * time.Microsecond,
+		250 * time.Millisecond,
+		3 * time.Second,
+		90 * time.Minute,
+	} {
+		var e Event
+		e.SetMetricDuration(d)
+		if _, ok := e.Metric.(float64); !ok {
+			t.Errorf("Metric for %v is a %T, want a float64", d, e.Metric)
+		}
+		if got, ok := e.MetricDuration(); !ok || got != d {
+			t.Errorf("MetricDuration is %v, %v, want %v", got, ok, d)
+		}
+	}
+
+	e := Event{Metric: 2}
+	if got, ok := e.MetricDuration(); !ok || got != 2*time.Second {
+		t.Errorf("MetricDuration of an int metric 2 is %v, %v, want 2s", got, ok)
+	}
+	e = Event{}
+	if _, ok := e.MetricDuration(); ok {
+		t.Error("MetricDuration is ok with no metric")
+	}
+}
+
+func TestMetricValue(t *testing.T) {
+	events := pbEventsToEvents([]*proto.Event{
+		{MetricSint64: pb.Int64(42)},
+		{MetricF: pb.Float32(0.5)},
+		{MetricD: pb.Float64(2.25)},
+	})
+	for i, expected := range []float64{42, 0.5, 2.25} {
+		if v, ok := events[i].MetricValue(); !ok || v != expected {
+			t.Errorf("MetricValue of %v is %v, %v, want %v", events[i].Metric, v, ok, expected)
+		}
+	}
+	if v, ok := (&Event{}).MetricValue(); ok {
+		t.Errorf("MetricValue without a metric is %v, true", v)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	e := &Event{
+		Service:    "requests",
+		Host:       "web1",
+		Metric:     1,
+		Tags:       []string{"web", "prod"},
+		Attributes: map[string]string{"region": "eu", "team": "a"},
+	}
+	other := &Event{
+		Host:       "web2",
+		Tags:       []string{"prod", "enriched"},
+		Attributes: map[string]string{"team": "b", "owner": "ops"},
+	}
+	e.Merge(other)
+
+	if e.Service != "requests" || e.Host != "web2" || e.Metric != 1 {
+		t.Errorf("Scalar fields merged to %+v", e)
+	}
+	if !reflect.DeepEqual(e.Tags, []string{"web", "prod", "enriched"}) {
+		t.Errorf("Tags merged to %v", e.Tags)
+	}
+	expected := map[string]string{"region": "eu", "team": "b", "owner": "ops"}
+	if !reflect.DeepEqual(e.Attributes, expected) {
+		t.Errorf("Attributes merged to %v, want %v", e.Attributes, expected)
+	}
+	e.Attributes["owner"] = "changed"
+	if other.Attributes["owner"] != "ops" {
+		t.Error("Merge shares the attributes of other")
+	}
+
+	e.Merge(&Event{ClearMetric: true})
+	if e.Metric != nil || !e.ClearMetric {
+		t.Errorf("Merging a cleared metric left %v, ClearMetric %v", e.Metric, e.ClearMetric)
+	}
+}
+
+func TestSetMetricJSON(t *testing.T) {
+	tests := []struct {
+		n        json.Number
+		expected interface{}
+	}{
+		{"42", int64(42)},
+		{"-7", int64(-7)},
+		{"1e3", int64(1000)},
+		{"0.25", 0.25},
+		{"1e30", 1e30},
+	}
+	for _, test := range tests {
+		var e Event
+		if err := e.SetMetricJSON(test.n); err != nil {
+			t.Fatal(err.Error())
+		}
+		if e.Metric != test.expected {
+			t.Errorf("SetMetricJSON(%s) set %v (%T), want %v (%T)",
+				test.n, e.Metric, e.Metric, test.expected, test.expected)
+		}
+	}
+
+	e := Event{Metric: 1}
+	if err := e.SetMetricJSON("forty-two"); err == nil {
+		t.Error("SetMetricJSON accepted a malformed number")
+	}
+	if e.Metric != 1 {
+		t.Errorf("SetMetricJSON changed the metric to %v on error", e.Metric)
+	}
+}
+
+func TestCounterAndGauge(t *testing.T) {
+	counter := NewCounter("requests", 3)
+	if counter.Service != "requests" || counter.Metric != 3.0 ||
+		!reflect.DeepEqual(counter.Tags, []string{"counter"}) {
+		t.Errorf("NewCounter returned %+v", counter)
+	}
+	gauge := NewGauge("queue size", 42)
+	if gauge.Service != "queue size" || gauge.Metric != 42.0 ||
+		!reflect.DeepEqual(gauge.Tags, []string{"gauge"}) {
+		t.Errorf("NewGauge returned %+v", gauge)
+	}
+}
+
+func TestSampleEvents(t *testing.T) {
+	labels := map[string]string{"method": "GET", "code": "200"}
+	events := NewSampleEvents([]Sample{
+		{"http_requests_total", labels, 1027},
+		{"up", nil, 1},
+	})
+	if len(events) != 2 {
+		t.Fatalf("%d events, want 2", len(events))
+	}
+	e := events[0]
+	if e.Service != "http_requests_total" || e.Metric != 1027.0 ||
+		!reflect.DeepEqual(e.Attributes, labels) {
+		t.Errorf("Sample converted to %+v", e)
+	}
+	labels["code"] = "500"
+	if e.Attributes["code"] != "200" {
+		t.Error("The labels are not copied")
+	}
+	if events[1].Attributes != nil {
+		t.Errorf("A sample without labels has attributes %v", events[1].Attributes)
+	}
+}
+
+func TestNewEphemeral(t *testing.T) {
+	e := NewEphemeral("audit")
+	if e.Service != "audit" || e.State != "expired" {
+		t.Errorf("NewEphemeral returned %+v", e)
+	}
+}
+
+func TestQueryCount(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	s.SetQueryResponse(&proto.Event{}, &proto.Event{}, &proto.Event{})
+	n, err := c.QueryCount("true")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n != 3 {
+		t.Errorf("QueryCount returned %d, want 3", n)
+	}
+}
+
+func TestOnReject(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	c, err := DialWithOptions("tcp", s.Addr, WithUDPFallback(1, time.Hour))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+
+	var rejected []*Event
+	var reasons []string
+	c.OnReject = func(event *Event, reason string) {
+		rejected = append(rejected, event)
+		reasons = append(reasons, reason)
+	}
+
+	s.SetError("no thanks")
+	event := &Event{Service: "rejected"}
+	if err = c.Send(event); err == nil || err.Error() != "no thanks" {
+		t.Errorf("Send returned %v, want the error of the server", err)
+	}
+	if len(rejected) != 1 || rejected[0] != event || reasons[0] != "no thanks" {
+		t.Errorf("OnReject called with %v, %v", rejected, reasons)
+	}
+	if c.Mode() != Normal {
+		t.Errorf("A rejection made the client fall back to UDP")
+	}
+}
+
+func TestQueryBatch(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	err := c.SendMulti([]*Event{{Service: "batch-1"}, {Service: "batch-2"}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	results, err := c.QueryBatch([]string{"true", "true", "true"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(results) != 3 {
+		t.Fatalf("QueryBatch returned %d results, want 3", len(results))
+	}
+	for i, events := range results {
+		if len(events) != 2 {
+			t.Errorf("Result %d has %d events, want 2", i, len(events))
+		}
+	}
+
+	// The connection is still in sync after a batch.
+	if _, err = c.Query("true"); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+type traceKey struct{}
+
+func TestSendContext(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	c.ContextExtractor = func(ctx context.Context) map[string]string {
+		if trace, ok := ctx.Value(traceKey{}).(string); ok {
+			return map[string]string{"trace": trace, "type": "extracted"}
+		}
+		return nil
+	}
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "abc")
+	event := &Event{Service: "context", Attributes: map[string]string{"type": "test"}}
+	if err := c.SendContext(ctx, event); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(event.Attributes) != 1 {
+		t.Errorf("SendContext modified the attributes of the event: %v", event.Attributes)
+	}
+
+	events := pbEventsToEvents(s.Events())
+	expected := map[string]string{"trace": "abc", "type": "test"}
+	if len(events) != 1 || !reflect.DeepEqual(events[0].Attributes, expected) {
+		t.Errorf("Server received %v, want attributes %v", events, expected)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := c.SendContext(canceled, event); err != context.Canceled {
+		t.Errorf("SendContext returned %v with a canceled context", err)
+	}
+}
+
+func TestScaleMetric(t *testing.T) {
+	type byteCount int64
+	tests := []struct {
+		metric   interface{}
+		expected interface{}
+	}{
+		{int8(10), int8(40)},
+		{int8(100), int64(400)},
+		{int16(-3), int16(-12)},
+		{int32(5), int32(20)},
+		{uint(2), uint(8)},
+		{uint8(3), uint8(12)},
+		{uint32(7), uint32(28)},
+		{byteCount(6), byteCount(24)},
+		{float32(0.5), float32(2)},
+		{1.25, 5.0},
+		{"text", "text"},
+		{nil, nil},
+	}
+	for _, test := range tests {
+		if scaled := scaleMetric(test.metric, 4); scaled != test.expected {
+			t.Errorf("%#v scaled by 4 is %#v, want %#v", test.metric, scaled, test.expected)
+		}
+	}
+}
+
+func TestSamplingClient(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	critical := func(e *Event) bool { return e.State == "critical" }
+	sampling := NewSamplingClient(c, 4, critical, true)
+	for i := 0; i < 8; i++ {
+		if err := sampling.Send(&Event{Service: "sampled", Metric: 1.5}); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if err := sampling.Send(&Event{Service: "sampled", State: "critical", Metric: 1}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	events := pbEventsToEvents(s.Events())
+	if len(events) != 3 {
+		t.Fatalf("%d events sent, want 3", len(events))
+	}
+	for _, e := range events[:2] {
+		if e.Metric != 6.0 {
+			t.Errorf("Sampled metric is %v, want 6", e.Metric)
+		}
+	}
+	if events[2].State != "critical" || events[2].Metric != int64(1) {
+		t.Errorf("Critical event sent as %+v", events[2])
+	}
+	if sampling.SampledIn() != 3 || sampling.Dropped() != 6 {
+		t.Errorf("%d events sampled in and %d dropped, want 3 and 6",
+			sampling.SampledIn(), sampling.Dropped())
+	}
+}
+
+func TestSendAndVerify(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	found, err := c.SendAndVerify(&Event{Service: "verified"}, time.Second)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !found {
+		t.Error("SendAndVerify did not find the event")
+	}
+
+	s.SetQueryResponse()
+	found, err = c.SendAndVerify(&Event{Service: "lost"}, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if found {
+		t.Error("SendAndVerify found an event missing from the index")
+	}
+}
+
+func TestSendAndVerifyAsSent(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+	c, err := DialWithOptions("tcp", s.Addr, WithHostFromConn())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+	c.ServicePrefix = "app"
+	var tap bytes.Buffer
+	c.TapWriter = &tap
+
+	if found, err := c.SendAndVerify(&Event{Service: "verified"}, time.Second); err != nil || !found {
+		t.Fatalf("SendAndVerify returned %v, %v", found, err)
+	}
+	var queries []string
+	for tap.Len() > 0 {
+		msg, err := new(tcp).readMsg(&tap)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if msg.Query != nil {
+			queries = append(queries, msg.Query.GetString_())
+		}
+	}
+	expected := `service = "app.verified" and host = "127.0.0.1"`
+	if len(queries) == 0 || queries[0] != expected {
+		t.Errorf("queries are %q, want %q", queries, expected)
+	}
+
+	c.ShouldSend = func(*Event) bool { return false }
+	start := time.Now()
+	if found, err := c.SendAndVerify(&Event{Service: "dropped"}, time.Second); err != nil || found {
+		t.Errorf("SendAndVerify of a dropped event returned %v, %v", found, err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("SendAndVerify of a dropped event took %v", elapsed)
+	}
+}
+
+func TestHybridClient(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	h, err := DialHybrid(s.Addr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer h.Close()
+
+	if err = h.SendFast(&Event{Service: "fast"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = h.SendReliable(&Event{Service: "reliable"}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(s.Events()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	events, err := h.Query("true")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(events) != 2 {
+		t.Errorf("Query returned %d events, want 2", len(events))
+	}
+}
+
+func TestHybridOversize(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	h, err := DialHybrid(s.Addr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer h.Close()
+
+	large := &Event{Service: "large", Attributes: map[string]string{"blob": strings.Repeat("x", 70000)}}
+	if err = h.SendFast(large); err != ErrOversize {
+		t.Errorf("SendFast of a large event returned %v, want ErrOversize", err)
+	}
+	h.OnOversize = OversizeDrop
+	if err = h.SendFast(large); err != nil {
+		t.Errorf("SendFast of a large event dropping it returned %v", err)
+	}
+	if n := len(s.Events()); n != 0 {
+		t.Errorf("%d events received, want 0", n)
+	}
+	h.OnOversize = OversizeTCP
+	if err = h.SendFast(large); err != nil {
+		t.Fatal(err.Error())
+	}
+	if events := s.Events(); len(events) != 1 || events[0].GetService() != "large" {
+		t.Errorf("events received over TCP are %v", events)
+	}
+}
+
+func TestSendDuplicated(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	h, err := DialHybrid(s.Addr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer h.Close()
+
+	d, err := h.SendDuplicated(&Event{Service: "critical"})
+	if err != nil || d.Reliable != nil || d.Fast != nil {
+		t.Fatalf("SendDuplicated returned %+v, %v", d, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(s.Events()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(s.Events()); n != 2 {
+		t.Errorf("Server received %d copies, want 2", n)
+	}
+
+	s.SetError("no")
+	d, err = h.SendDuplicated(&Event{Service: "critical"})
+	if err != nil || d.Reliable == nil || d.Fast != nil {
+		t.Errorf("SendDuplicated with TCP failing returned %+v, %v", d, err)
+	}
+}
+
+func TestTypedAttributes(t *testing.T) {
+	e := &Event{Attributes: map[string]string{
+		"count": "42",
+		"ratio": "0.25",
+		"ok":    "true",
+		"text":  "hello",
+	}}
+
+	if i, ok := e.AttributeInt("count"); !ok || i != 42 {
+		t.Errorf("AttributeInt(count) is %v, %v", i, ok)
+	}
+	if f, ok := e.AttributeFloat("ratio"); !ok || f != 0.25 {
+		t.Errorf("AttributeFloat(ratio) is %v, %v", f, ok)
+	}
+	if b, ok := e.AttributeBool("ok"); !ok || !b {
+		t.Errorf("AttributeBool(ok) is %v, %v", b, ok)
+	}
+	if _, ok := e.AttributeInt("ratio"); ok {
+		t.Error("AttributeInt(ratio) is ok")
+	}
+	if _, ok := e.AttributeFloat("text"); ok {
+		t.Error("AttributeFloat(text) is ok")
+	}
+	if _, ok := e.AttributeBool("missing"); ok {
+		t.Error("AttributeBool(missing) is ok")
+	}
+}
+
+func TestBinaryAttribute(t *testing.T) {
+	var e Event
+	for _, data := range [][]byte{{0, 1, 0xfe, 0xff}, {}} {
+		e.SetBinaryAttribute("trace", data)
+		got, ok := e.BinaryAttribute("trace")
+		if !ok || !bytes.Equal(got, data) {
+			t.Errorf("BinaryAttribute is %x, %v, want %x", got, ok, data)
+		}
+	}
+	e.Attributes["text"] = "not base64!"
+	if _, ok := e.BinaryAttribute("text"); ok {
+		t.Error("BinaryAttribute(text) is ok")
+	}
+	if _, ok := e.BinaryAttribute("missing"); ok {
+		t.Error("BinaryAttribute(missing) is ok")
+	}
+}
+
+func TestServerError(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	s.SetError("Rate limit exceeded")
+	err := c.Send(&Event{Service: "rejected"})
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) {
+		t.Fatalf("Send returned %v (%T), want a *ServerError", err, err)
+	}
+	if serverErr.Message != "Rate limit exceeded" || !serverErr.IsRateLimited() {
+		t.Errorf("Unexpected server error %+v", serverErr)
+	}
+
+	tests := []struct {
+		message                        string
+		rateLimited, overloaded, parse bool
+	}{
+		{"too many requests", true, false, false},
+		{"server overloaded", false, true, false},
+		{"Server is shutting down", false, true, false},
+		{"parse error: invalid term", false, false, true},
+		{"something else", false, false, false},
+	}
+	if !(&ServerError{Message: "Server is shutting down"}).IsShuttingDown() {
+		t.Error("IsShuttingDown is false for a shutdown")
+	}
+	if (&ServerError{Message: "shutdown-hook failed"}).IsShuttingDown() {
+		t.Error("IsShuttingDown is true for an unrelated message")
+	}
+	defer func(messages []string) { ShutdownMessages = messages }(ShutdownMessages)
+	ShutdownMessages = []string{"Draining"}
+	if !(&ServerError{Message: "node draining"}).IsShuttingDown() {
+		t.Error("IsShuttingDown ignores ShutdownMessages")
+	}
+	ShutdownMessages = []string{"shutting down"}
+	for _, test := range tests {
+		e := &ServerError{Message: test.message}
+		if e.IsRateLimited() != test.rateLimited || e.IsOverloaded() != test.overloaded ||
+			e.IsParseError() != test.parse || e.Error() != test.message {
+			t.Errorf("Unexpected predicates for %q", test.message)
+		}
+	}
+}
+
+// stubNetwork is a transport answering every message with response and err.
+type stubNetwork struct {
+	response *proto.Msg
+	err      error
+}
+
+func (n *stubNetwork) Send(message *proto.Msg, conn net.Conn) (*proto.Msg, error) {
+	return n.response, n.err
+}
+
+func TestQuerySorted(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	s.SetQueryResponse(
+		&proto.Event{Service: pb.String("b"), Time: pb.Int64(20)},
+		&proto.Event{Service: pb.String("a"), Time: pb.Int64(10)},
+		&proto.Event{Service: pb.String("c"), TimeMicros: pb.Int64(20000001)},
+		&proto.Event{Service: pb.String("b2"), Time: pb.Int64(20)},
+	)
+	for order, expected := range map[Order]string{
+		OldestFirst: "a b b2 c",
+		NewestFirst: "c b b2 a",
+	} {
+		events, err := c.QuerySorted("true", order)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		var services []string
+		for _, e := range events {
+			services = append(services, e.Service)
+		}
+		if got := strings.Join(services, " "); got != expected {
+			t.Errorf("Order %v returned %q, want %q", order, got, expected)
+		}
+	}
+}
+
+func TestQueryViews(t *testing.T) {
+	s, c := dialTestServer(t, "tcp")
+	defer s.Close()
+	defer c.Close()
+
+	s.SetQueryResponse(&proto.Event{
+		Service:    pb.String("view"),
+		Host:       pb.String("raidman"),
+		MetricD:    pb.Float64(1.5),
+		Attributes: []*proto.Attribute{{Key: pb.String("k"), Value: pb.String("v")}},
+	})
+	var views int
+	err := c.QueryViews("true", func(v EventView) {
+		views++
+		if v.Service() != "view" || v.Host() != "raidman" || v.Metric() != 1.5 {
+			t.Errorf("Unexpected view %+v", v.Event())
+		}
+		if value, ok := v.Attribute("k"); !ok || value != "v" {
+			t.Errorf("Attribute(k) is %q, %v", value, ok)
+		}
+		if _, ok := v.Attribute("missing"); ok {
+			t.Error("Attribute(missing) is ok")
+		}
+		if e := v.Event(); e.Service != "view" || e.Attributes["k"] != "v" {
+			t.Errorf("Event copied to %+v", e)
+		}
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if views != 1 {
+		t.Errorf("QueryViews passed %d views, want 1", views)
+	}
+}
+
+func TestQueryNilResponse(t *testing.T) {
+	c := &Client{net: &stubNetwork{}}
+	events, err := c.Query("true")
+	if err != nil || len(events) != 0 {
+		t.Errorf("Query returned %v, %v, want no events and no error", events, err)
+	}
+	n, err := c.QueryCount("true")
+	if err != nil || n != 0 {
+		t.Errorf("QueryCount returned %v, %v, want 0 and no error", n, err)
+	}
+}
+
+func TestQueryRejected(t *testing.T) {
+	c := &Client{net: &stubNetwork{
+		response: &proto.Msg{Ok: pb.Bool(false), Error: pb.String("parse error")},
+	}}
+	events, err := c.Query("service = ")
+	if err == nil || err.Error() != "parse error" {
+		t.Errorf("Query returned %v, %v, want the error of the server", events, err)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	c, err := DialWithOptions("tcp", s.Addr, WithIdleTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+
+	first := c.Conn()
+	if err = c.Send(&Event{Service: "idle"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	c.Lock()
+	idle := c.idle
+	c.Unlock()
+	if !idle {
+		t.Fatal("The connection was not closed while idle")
+	}
+	if err = c.Send(&Event{Service: "idle"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if c.Conn() == first {
+		t.Error("Send did not dial a new connection")
+	}
+	if n := len(s.Events()); n != 2 {
+		t.Errorf("%d events sent, want 2", n)
+	}
+}
+
+func TestIdleTimeoutClose(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	c, err := DialWithOptions("tcp", s.Addr, WithIdleTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	c.Lock()
+	idle := c.idle
+	c.Unlock()
+	if !idle {
+		t.Fatal("The connection was not closed while idle")
+	}
+	if err = c.Close(); err != nil {
+		t.Errorf("Close after the idle timeout: %v", err)
+	}
+}
+
+func TestMux(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	m, err := DialMux("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := m.Send(&Event{Service: "mux", Metric: i}); err != nil {
+				t.Error(err.Error())
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(s.Events()); n != 50 {
+		t.Errorf("%d events received, want 50", n)
+	}
+
+	m.Close()
+	if err := m.Send(&Event{Service: "mux"}); err == nil {
+		t.Error("send on a closed mux succeeded")
+	}
+}
+
+func TestMuxUDP(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	if _, err := DialMux("udp", s.Addr); err == nil {
+		t.Error("mux dialed over udp")
+	}
+}
+
+func TestIsZero(t *testing.T) {
+	event := &Event{
+		Time: 1,
+	}
+	elem := reflect.ValueOf(event).Elem()
+	eventType := elem.Type()
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Field(i)
+		name := eventType.Field(i).Name
+		if name == "Time" {
+			if isZero(field) {
+				t.Error("Time should not be zero")
+			}
+		} else {
+			if !isZero(field) {
+				t.Errorf("%s should be zero", name)
+			}
+		}
+	}
+}
+
+func TestPbEventsToEventsMetric(t *testing.T) {
+	events := pbEventsToEvents([]*proto.Event{
+		{MetricF: pb.Float32(1.5)},
+		{MetricD: pb.Float64(2.5), MetricF: pb.Float32(2.5)},
+		{MetricSint64: pb.Int64(3), MetricF: pb.Float32(3)},
+		{},
+	})
+	expected := []interface{}{float64(1.5), float64(2.5), int64(3), int64(0)}
+	for i, e := range events {
+		if e.Metric != expected[i] {
+			t.Errorf("Metric of event %d is %#v, want %#v", i, e.Metric, expected[i])
+		}
+	}
+}
+
+func TestTimeMicros(t *testing.T) {
+	e, err := eventToPbEvent(&Event{Host: "raidman", TimeMicros: 1500000000123456})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if e.GetTimeMicros() != 1500000000123456 || e.Time != nil {
+		t.Errorf("TimeMicros is sent as %v", e)
+	}
+	events := pbEventsToEvents([]*proto.Event{e})
+	if events[0].TimeMicros != 1500000000123456 {
+		t.Errorf("TimeMicros is read back as %v", events[0].TimeMicros)
+	}
+}
+
+func TestClearMetric(t *testing.T) {
+	for _, metric := range []interface{}{nil, 0, 42, 1.5} {
+		e, err := eventToPbEvent(&Event{Host: "raidman", Service: "gauge", Ttl: 1, Metric: metric, ClearMetric: true})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if e.MetricSint64 != nil || e.MetricD != nil || e.MetricF != nil {
+			t.Errorf("metric %v is sent as %v", metric, e)
+		}
+		if e.GetTtl() != 1 {
+			t.Errorf("ttl is sent as %v", e.GetTtl())
+		}
+	}
+}
+
+func TestDialer(t *testing.T) {
+	proxyAddr := "localhost:9999"
+	os.Setenv("RIEMANN_PROXY", "socks5://"+proxyAddr)
+	defer os.Unsetenv("RIEMANN_PROXY")
+	dialer, err := newDialer()
+	if err != nil {
+		t.Error(err.Error())
+	}
+	val := reflect.Indirect(reflect.ValueOf(dialer))
+	// this is a horrible hack but proxy.Dialer exports nothing.
+	addr := fmt.Sprintf("%s", val.FieldByName("addr"))
+	if addr != proxyAddr {
+		t.Errorf("RIEMANN_PROXY is set and is %s but dialer's proxy is %s", proxyAddr, addr)
+	}
+}
+
+// replayConn is a connection reading the same bytes over and over.
+type replayConn struct {
+	net.Conn
+	data   []byte
+	reader *bytes.Reader
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	if c.reader.Len() == 0 {
+		c.reader.Reset(c.data)
+	}
+	return c.reader.Read(p)
+}
+
+func BenchmarkReadAck(b *testing.B) {
+	data, err := pb.Marshal(&proto.Msg{Ok: pb.Bool(true)})
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+	frame := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	frame = append(frame, data...)
+
+	b.Run("reused", func(b *testing.B) {
+		conn := &replayConn{data: frame, reader: bytes.NewReader(frame)}
+		network := new(tcp)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := network.read(conn); err != nil {
+				b.Fatal(err.Error())
+			}
+		}
+	})
+	b.Run("fresh", func(b *testing.B) {
+		conn := &replayConn{data: frame, reader: bytes.NewReader(frame)}
+		network := new(tcp)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			network.buf = nil
+			if _, err := network.read(conn); err != nil {
+				b.Fatal(err.Error())
+			}
+		}
+	})
+}
+
+var benchmarkEvent = &Event{
+	State:       "good",
+	Host:        "raidman",
+	Service:     "benchmark",
+	Metric:      42.5,
+	Description: "benchmark event",
+	Tags:        []string{"a", "b"},
+	Attributes:  map[string]string{"k": "v"},
+}
+
+func BenchmarkEventToPbEvent(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := eventToPbEvent(benchmarkEvent); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+func BenchmarkMarshalSize(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		MarshalSize(benchmarkEvent)
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	e, err := eventToPbEvent(benchmarkEvent)
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+	message := &proto.Msg{Events: []*proto.Event{e}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := pb.Marshal(message); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+// writeCounter counts the writes teed to it.
+type writeCounter struct {
+	writes int64
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+	atomic.AddInt64(&w.writes, 1)
+	return len(p), nil
+}
+
+func BenchmarkConcurrentSend(b *testing.B) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	for _, bench := range []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"coalescing", []Option{WithCoalescing()}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			c, err := DialWithOptions("tcp", s.Addr, bench.opts...)
+			if err != nil {
+				b.Fatal(err.Error())
+			}
+			defer c.Close()
+			counter := new(writeCounter)
+			c.TapWriter = counter
+
+			b.RunParallel(func(pb *testing.PB) {
+				event := &Event{Host: "raidman", Service: "benchmark"}
+				for pb.Next() {
+					if err := c.Send(event); err != nil {
+						b.Error(err.Error())
+					}
+				}
+			})
+			b.ReportMetric(float64(atomic.LoadInt64(&counter.writes))/float64(b.N), "writes/op")
+		})
+	}
+}
+
+func BenchmarkMux(b *testing.B) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	b.Run("mux", func(b *testing.B) {
+		m, err := DialMux("tcp", s.Addr)
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+		defer m.Close()
+
+		b.RunParallel(func(pb *testing.PB) {
+			event := &Event{Host: "raidman", Service: "benchmark"}
+			for pb.Next() {
+				if err := m.Send(event); err != nil {
+					b.Error(err.Error())
+				}
+			}
+		})
+	})
+	b.Run("connections", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			c, err := Dial("tcp", s.Addr)
+			if err != nil {
+				b.Error(err.Error())
+				return
+			}
+			defer c.Close()
+			event := &Event{Host: "raidman", Service: "benchmark"}
+			for pb.Next() {
+				if err := c.Send(event); err != nil {
+					b.Error(err.Error())
+				}
+			}
+		})
+	})
+}
+
+func BenchmarkQueryDecode(b *testing.B) {
+	response := &proto.Msg{Ok: pb.Bool(true)}
+	for i := 0; i < 10000; i++ {
+		response.Events = append(response.Events, &proto.Event{
+			Service:     pb.String("benchmark"),
+			Host:        pb.String("raidman"),
+			Description: pb.String("a query result"),
+			Tags:        []string{"a", "b"},
+			MetricD:     pb.Float64(float64(i)),
+			Attributes:  []*proto.Attribute{{Key: pb.String("k"), Value: pb.String("v")}},
+		})
+	}
+	data, err := pb.Marshal(response)
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+
+	decode := func(b *testing.B) []*proto.Event {
+		msg := &proto.Msg{}
+		if err := pb.Unmarshal(data, msg); err != nil {
+			b.Fatal(err.Error())
+		}
+		return msg.GetEvents()
+	}
+	b.Run("events", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			pbEventsToEvents(decode(b))
+		}
+	})
+	b.Run("views", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, e := range decode(b) {
+				_ = EventView{e}.Service()
+			}
+		}
+	})
+}
+
+func BenchmarkTCP(b *testing.B) {
+	c, err := Dial("tcp", "localhost:5555")
+
+	var event = &Event{
+		State:   "good",
+		Host:    "raidman",
+		Service: "benchmark",
+	}
+
+	if err == nil {
+		for i := 0; i < b.N; i++ {
+			c.Send(event)
+		}
+	}
+	c.Close()
+}
+
+func BenchmarkUDP(b *testing.B) {
+	c, err := Dial("udp", "localhost:5555")
+
+	var event = &Event{
+		State:   "good",
+		Host:    "raidman",
+		Service: "benchmark",
+	}
+
+	if err == nil {
+		for i := 0; i < b.N; i++ {
+			c.Send(event)
+		}
+	}
+	c.Close()
+}
+
+func BenchmarkConcurrentTCP(b *testing.B) {
+	c, err := Dial("tcp", "localhost:5555")
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+
+	var event = &Event{
+		Host:    "raidman",
+		Service: "tcp_concurrent",
+		Tags:    []string{"concurrent", "tcp", "benchmark"},
+	}
+
+	ch := make(chan int, b.N)
+	for i := 0; i < b.N; i++ {
+		go func(metric int) {
+			event.Metric = metric
+			err = c.Send(event)
+			ch <- i
+		}(i)
+	}
+	<-ch
+
+	c.Close()
+}
+
+func BenchmarkConcurrentUDP(b *testing.B) {
+	c, err := Dial("udp", "localhost:5555")
+	if err != nil {
+		b.Fatal(err.Error())
+	}
 
 	var event = &Event{
 		Host:    "raidman",
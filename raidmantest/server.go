@@ -0,0 +1,190 @@
+// Package raidmantest provides an in-memory Riemann server for testing
+// code that talks to Riemann.
+package raidmantest
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/amir/raidman/proto"
+	pb "github.com/golang/protobuf/proto"
+)
+
+// A Server accepts Riemann messages over TCP and UDP on the same local
+// address, records the events it receives and acknowledges every message
+// with ok.
+//
+// Queries are not evaluated: they are answered with the events set by
+// SetQueryResponse or, if it was never called, with every recorded event.
+type Server struct {
+	// Addr is the host:port both listeners are bound to.
+	Addr string
+
+	mu            sync.Mutex
+	events        []*proto.Event
+	queryResponse []*proto.Event
+	queryIsSet    bool
+	err           string
+	conns         map[net.Conn]struct{}
+
+	tcp net.Listener
+	udp net.PacketConn
+	wg  sync.WaitGroup
+}
+
+// NewServer starts a Server listening on a free port of the loopback
+// interface. Callers should Close it when done.
+func NewServer() (*Server, error) {
+	var err error
+	// The TCP port may already be taken for UDP, so try a few times.
+	for i := 0; i < 10; i++ {
+		var l net.Listener
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		var pc net.PacketConn
+		pc, err = net.ListenPacket("udp", l.Addr().String())
+		if err != nil {
+			l.Close()
+			continue
+		}
+		s := &Server{
+			Addr:  l.Addr().String(),
+			conns: make(map[net.Conn]struct{}),
+			tcp:   l,
+			udp:   pc,
+		}
+		s.wg.Add(2)
+		go s.serveTCP()
+		go s.serveUDP()
+		return s, nil
+	}
+	return nil, err
+}
+
+// Events returns the events received so far, in the order they arrived.
+func (s *Server) Events() []*proto.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]*proto.Event, len(s.events))
+	copy(events, s.events)
+	return events
+}
+
+// SetQueryResponse sets the events returned for every subsequent query.
+func (s *Server) SetQueryResponse(events ...*proto.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queryResponse = events
+	s.queryIsSet = true
+}
+
+// SetError makes the server reject every subsequent message by answering
+// ok=false with the error message err, or accept them again if err is empty.
+// Events of rejected messages are not recorded.
+func (s *Server) SetError(err string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// Close stops the listeners, closes open connections and waits for them to
+// be released.
+func (s *Server) Close() error {
+	err := s.tcp.Close()
+	if uerr := s.udp.Close(); err == nil {
+		err = uerr
+	}
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		var header uint32
+		if err := binary.Read(conn, binary.BigEndian, &header); err != nil {
+			return
+		}
+		data := make([]byte, header)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+		msg := &proto.Msg{}
+		if err := pb.Unmarshal(data, msg); err != nil {
+			return
+		}
+		data, err := pb.Marshal(s.handle(msg))
+		if err != nil {
+			return
+		}
+		frame := make([]byte, 4, 4+len(data))
+		binary.BigEndian.PutUint32(frame, uint32(len(data)))
+		if _, err := conn.Write(append(frame, data...)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		msg := &proto.Msg{}
+		if err := pb.Unmarshal(buf[:n], msg); err != nil {
+			continue
+		}
+		s.handle(msg)
+	}
+}
+
+func (s *Server) handle(msg *proto.Msg) *proto.Msg {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != "" {
+		return &proto.Msg{Ok: pb.Bool(false), Error: pb.String(s.err)}
+	}
+	s.events = append(s.events, msg.GetEvents()...)
+	response := &proto.Msg{Ok: pb.Bool(true)}
+	if msg.Query != nil {
+		if s.queryIsSet {
+			response.Events = s.queryResponse
+		} else {
+			response.Events = s.events
+		}
+	}
+	return response
+}
@@ -0,0 +1,80 @@
+package raidmantest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/amir/raidman"
+	"github.com/amir/raidman/proto"
+	"github.com/amir/raidman/raidmantest"
+	pb "github.com/golang/protobuf/proto"
+)
+
+func TestServerTCP(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	c, err := raidman.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+
+	err = c.Send(&raidman.Event{Host: "raidman", Service: "tcp", Metric: 42})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	events := s.Events()
+	if len(events) != 1 || events[0].GetService() != "tcp" {
+		t.Fatalf("Server recorded %v", events)
+	}
+
+	queried, err := c.Query("service = \"tcp\"")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(queried) != 1 || queried[0].Metric != int64(42) {
+		t.Errorf("Query returned %v", queried)
+	}
+
+	s.SetQueryResponse(&proto.Event{Service: pb.String("canned")})
+	queried, err = c.Query("true")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(queried) != 1 || queried[0].Service != "canned" {
+		t.Errorf("Query returned %v, want the canned response", queried)
+	}
+}
+
+func TestServerUDP(t *testing.T) {
+	s, err := raidmantest.NewServer()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+
+	c, err := raidman.Dial("udp", s.Addr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+
+	err = c.Send(&raidman.Event{Host: "raidman", Service: "udp"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(s.Events()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	events := s.Events()
+	if len(events) != 1 || events[0].GetService() != "udp" {
+		t.Errorf("Server recorded %v", events)
+	}
+}
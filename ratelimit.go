@@ -0,0 +1,121 @@
+package raidman
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A RateLimitPolicy decides what a RateLimitedClient does with events sent
+// while its token bucket is empty.
+type RateLimitPolicy int
+
+const (
+	// Block waits until a token becomes available, unless the rate is
+	// not positive and none ever will.
+	Block RateLimitPolicy = iota
+	// Drop discards the event and counts it as dropped.
+	Drop
+)
+
+// RateLimitedClient wraps a Client with a token bucket limiting the number
+// of events sent per second. Every event consumes one token. It only exposes
+// the operations it limits, so that no send bypasses the limit.
+type RateLimitedClient struct {
+	client  *Client
+	policy  RateLimitPolicy
+	dropped atomic.Uint64
+
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimitedClient returns a RateLimitedClient sending through c at
+// most eventsPerSecond events per second, with bursts of up to burst events.
+//
+// If eventsPerSecond is not positive, the bucket never refills: once burst
+// events are sent, later events are dropped whatever the policy, since Block
+// would wait forever.
+func NewRateLimitedClient(c *Client, eventsPerSecond float64, burst int, policy RateLimitPolicy) *RateLimitedClient {
+	return &RateLimitedClient{
+		client: c,
+		policy: policy,
+		rate:   eventsPerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   c.timeNow(),
+	}
+}
+
+// Send sends an event to Riemann once a token is available, or drops it if
+// the policy is Drop and the bucket is empty.
+func (r *RateLimitedClient) Send(event *Event, opts ...SendOption) error {
+	return r.SendMulti([]*Event{event}, opts...)
+}
+
+// SendMulti sends multiple events to Riemann, taking a token for each of
+// them. With the Drop policy, events for which no token is left are dropped
+// and the rest are sent.
+func (r *RateLimitedClient) SendMulti(events []*Event, opts ...SendOption) error {
+	allowed := make([]*Event, 0, len(events))
+	for _, event := range events {
+		if r.take() {
+			allowed = append(allowed, event)
+		} else {
+			r.dropped.Add(1)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	return r.client.SendMulti(allowed, opts...)
+}
+
+// Query returns a list of events matched by query, through the wrapped
+// Client.
+func (r *RateLimitedClient) Query(q string) ([]Event, error) {
+	return r.client.Query(q)
+}
+
+// Close closes the wrapped Client.
+func (r *RateLimitedClient) Close() error {
+	return r.client.Close()
+}
+
+// Dropped returns the number of events dropped because of the rate limit.
+func (r *RateLimitedClient) Dropped() uint64 {
+	return r.dropped.Load()
+}
+
+// take takes a token from the bucket, waiting for it with the Block policy.
+// It reports whether the token was obtained.
+func (r *RateLimitedClient) take() bool {
+	r.mu.Lock()
+	now := r.client.timeNow()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+
+	if r.tokens >= 1 {
+		r.tokens--
+		r.mu.Unlock()
+		return true
+	}
+	if r.policy == Drop || r.rate <= 0 {
+		r.mu.Unlock()
+		return false
+	}
+
+	// Reserve the token now so waiters are served in order, and wait
+	// until the bucket has refilled up to it.
+	r.tokens--
+	wait := time.Duration(-r.tokens / r.rate * float64(time.Second))
+	r.mu.Unlock()
+	time.Sleep(wait)
+	return true
+}
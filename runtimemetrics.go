@@ -0,0 +1,146 @@
+package raidman
+
+import (
+	"math"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runtimeQuantiles are the quantiles a histogram of runtime/metrics is
+// summarized by, along the suffix of their service.
+var runtimeQuantiles = []struct {
+	suffix string
+	q      float64
+}{
+	{"p50", 0.5},
+	{"p90", 0.9},
+	{"p99", 0.99},
+}
+
+// RuntimeMetricEvents reads the runtime/metrics samples called names, or
+// every supported metric if names is nil, and returns them as events, ready
+// to be sent with SendMulti. Unknown names are skipped.
+//
+// The service of an event is the name of its metric, such as
+// "/gc/heap/allocs:bytes". Metrics of kind KindUint64 are sent as integer
+// metrics and those of kind KindFloat64 as float metrics. A KindFloat64Histogram
+// is summarized by an event per quantile, whose service is its name followed
+// by "p50", "p90" or "p99" and whose metric is the upper bound of the bucket
+// the quantile falls in, and by a "count" event with the number of samples
+// it holds, all joined with ServiceSeparator.
+func RuntimeMetricEvents(names []string) []*Event {
+	return runtimeMetricEvents(names, func(parts ...string) string {
+		return strings.Join(parts, ServiceSeparator)
+	})
+}
+
+// runtimeMetricEvents is RuntimeMetricEvents, joining the service names of
+// histogram summaries with join.
+func runtimeMetricEvents(names []string, join func(parts ...string) string) []*Event {
+	if names == nil {
+		for _, d := range metrics.All() {
+			names = append(names, d.Name)
+		}
+	}
+	samples := make([]metrics.Sample, len(names))
+	for i, name := range names {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+
+	var events []*Event
+	for _, s := range samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			var metric interface{} = s.Value.Uint64()
+			if s.Value.Uint64() > math.MaxInt64 {
+				metric = float64(s.Value.Uint64())
+			}
+			events = append(events, &Event{Service: s.Name, Metric: metric})
+		case metrics.KindFloat64:
+			events = append(events, &Event{Service: s.Name, Metric: s.Value.Float64()})
+		case metrics.KindFloat64Histogram:
+			h := s.Value.Float64Histogram()
+			var count uint64
+			for _, n := range h.Counts {
+				count += n
+			}
+			for _, q := range runtimeQuantiles {
+				events = append(events, &Event{
+					Service: join(s.Name, q.suffix),
+					Metric:  histogramQuantile(h, count, q.q),
+				})
+			}
+			events = append(events, &Event{
+				Service: join(s.Name, "count"),
+				Metric:  int64(count),
+			})
+		}
+	}
+	return events
+}
+
+// histogramQuantile returns the upper bound of the bucket of h, holding count
+// samples, the quantile q falls in, or its lower bound for the last bucket
+// if unbounded. It returns 0 if h is empty.
+func histogramQuantile(h *metrics.Float64Histogram, count uint64, q float64) float64 {
+	if count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(count)))
+	var seen uint64
+	for i, n := range h.Counts {
+		seen += n
+		if seen >= rank && n > 0 {
+			if math.IsInf(h.Buckets[i+1], 1) {
+				return h.Buckets[i]
+			}
+			return h.Buckets[i+1]
+		}
+	}
+	return h.Buckets[len(h.Buckets)-1]
+}
+
+// StartRuntimeMetrics sends the runtime/metrics samples called names, as
+// RuntimeMetricEvents returns them, right away and then every interval, until
+// the returned stop function is called. Stop waits for the reporting
+// goroutine to exit and may be called more than once. Closing c stops the
+// reporting too. The services of histogram summaries are joined by the
+// ServiceFormatter of c, if set. The ttl of the events is derived from
+// interval as set by WithReportTTLMultiplier.
+func (c *Client) StartRuntimeMetrics(names []string, interval time.Duration) (stop func()) {
+	ttl := c.reportTTL(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	started := c.goBackground(func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			events := runtimeMetricEvents(names, c.serviceName)
+			for _, e := range events {
+				e.Ttl = ttl
+			}
+			c.backgroundError(c.SendMulti(events))
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			case <-c.done:
+				return
+			}
+		}
+	})
+	if !started {
+		close(stopped)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
@@ -0,0 +1,83 @@
+package raidman
+
+import "sync/atomic"
+
+// SamplingClient wraps a Client and sends only one in every rate events,
+// except for events its always predicate selects, which are always sent. It
+// only exposes the operations it samples, so that no send bypasses it.
+type SamplingClient struct {
+	client      *Client
+	rate        int
+	always      func(*Event) bool
+	scaleMetric bool
+
+	seen    atomic.Uint64
+	sampled atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// NewSamplingClient returns a SamplingClient sending through c one in every
+// rate events, plus every event for which always, if not nil, returns true.
+// If scaleMetric is true, the metric of events sent by sampling is
+// multiplied by rate to compensate for the dropped ones.
+func NewSamplingClient(c *Client, rate int, always func(*Event) bool, scaleMetric bool) *SamplingClient {
+	return &SamplingClient{
+		client:      c,
+		rate:        rate,
+		always:      always,
+		scaleMetric: scaleMetric,
+	}
+}
+
+// Send sends an event to Riemann if it is sampled in.
+func (s *SamplingClient) Send(event *Event, opts ...SendOption) error {
+	return s.SendMulti([]*Event{event}, opts...)
+}
+
+// SendMulti sends the events that are sampled in to Riemann.
+func (s *SamplingClient) SendMulti(events []*Event, opts ...SendOption) error {
+	sampled := make([]*Event, 0, len(events))
+	for _, event := range events {
+		if event != nil && s.always != nil && s.always(event) {
+			sampled = append(sampled, event)
+			continue
+		}
+		if s.rate > 1 && (s.seen.Add(1)-1)%uint64(s.rate) != 0 {
+			s.dropped.Add(1)
+			continue
+		}
+		if event != nil && s.scaleMetric && s.rate > 1 {
+			e := *event
+			e.Metric = scaleMetric(e.Metric, float64(s.rate))
+			event = &e
+		}
+		sampled = append(sampled, event)
+	}
+	s.sampled.Add(uint64(len(sampled)))
+	if len(sampled) == 0 {
+		return nil
+	}
+	return s.client.SendMulti(sampled, opts...)
+}
+
+// Query returns a list of events matched by query, through the wrapped
+// Client.
+func (s *SamplingClient) Query(q string) ([]Event, error) {
+	return s.client.Query(q)
+}
+
+// Close closes the wrapped Client.
+func (s *SamplingClient) Close() error {
+	return s.client.Close()
+}
+
+// SampledIn returns the number of events passed on to be sent, including
+// those selected by the always predicate.
+func (s *SamplingClient) SampledIn() uint64 {
+	return s.sampled.Load()
+}
+
+// Dropped returns the number of events dropped by sampling.
+func (s *SamplingClient) Dropped() uint64 {
+	return s.dropped.Load()
+}
@@ -0,0 +1,60 @@
+package raidman
+
+import "time"
+
+// A SendOption adjusts a single call to Send or SendMulti.
+type SendOption func(*sendOptions)
+
+type sendOptions struct {
+	timeout time.Duration
+	tags    []string
+}
+
+// WithSendTimeout bounds the send to timeout, in addition to the timeout of
+// the Client.
+func WithSendTimeout(timeout time.Duration) SendOption {
+	return func(o *sendOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithExtraTag adds tag to the events sent, without changing the events
+// passed in.
+func WithExtraTag(tag string) SendOption {
+	return func(o *sendOptions) {
+		o.tags = append(o.tags, tag)
+	}
+}
+
+func newSendOptions(opts []SendOption) *sendOptions {
+	o := new(sendOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// deadline returns the deadline of the send, or zero if it has none.
+func (o *sendOptions) deadline() time.Time {
+	if o.timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(o.timeout)
+}
+
+// events returns events as adjusted by o, copying those it changes.
+func (o *sendOptions) events(events []*Event) []*Event {
+	if len(o.tags) == 0 {
+		return events
+	}
+	adjusted := make([]*Event, len(events))
+	for i, event := range events {
+		if event == nil {
+			continue
+		}
+		e := *event
+		e.Tags = append(append([]string(nil), event.Tags...), o.tags...)
+		adjusted[i] = &e
+	}
+	return adjusted
+}
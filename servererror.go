@@ -0,0 +1,61 @@
+package raidman
+
+import "strings"
+
+// A ServerError is an error message of Riemann, answering a message with
+// ok=false. Riemann error messages are free-form: ServerError recognizes
+// the common ones, but always keeps the message as sent.
+type ServerError struct {
+	Message string // the error as sent by the server
+}
+
+func newServerError(message string) *ServerError {
+	return &ServerError{Message: message}
+}
+
+func (e *ServerError) Error() string {
+	return e.Message
+}
+
+// IsRateLimited reports whether the server rejected the message for exceeding
+// a rate limit, as proxies and rate-limiting streams in front of Riemann do.
+func (e *ServerError) IsRateLimited() bool {
+	return e.contains("rate limit", "rate-limit", "too many")
+}
+
+// IsOverloaded reports whether the server rejected the message because it is
+// overloaded or shutting down, in which case sending later may succeed.
+func (e *ServerError) IsOverloaded() bool {
+	return e.contains("overload", "rejected execution") || e.IsShuttingDown()
+}
+
+// ShutdownMessages are the patterns IsShuttingDown looks for in the message
+// of a ServerError, in any case. By default it only holds "shutting down",
+// as Riemann and the proxies in front of it report a restart in progress.
+// Set it before the errors of any Client are inspected to recognize other
+// messages.
+var ShutdownMessages = []string{"shutting down"}
+
+// IsShuttingDown reports whether the server rejected the message because it
+// is draining for a restart, in which case the connection should be
+// replaced once the server is back. The message is matched against
+// ShutdownMessages.
+func (e *ServerError) IsShuttingDown() bool {
+	return e.contains(ShutdownMessages...)
+}
+
+// IsParseError reports whether the server could not parse a query.
+func (e *ServerError) IsParseError() bool {
+	return e.contains("parse error")
+}
+
+// contains reports whether the message contains any of patterns, in any case.
+func (e *ServerError) contains(patterns ...string) bool {
+	message := strings.ToLower(e.Message)
+	for _, pattern := range patterns {
+		if strings.Contains(message, strings.ToLower(pattern)) {
+			return true
+		}
+	}
+	return false
+}
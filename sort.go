@@ -0,0 +1,38 @@
+package raidman
+
+import "sort"
+
+// Order is the order QuerySorted returns events in.
+type Order int
+
+const (
+	// OldestFirst sorts events by ascending time.
+	OldestFirst Order = iota
+	// NewestFirst sorts events by descending time.
+	NewestFirst
+)
+
+// QuerySorted returns a list of events matched by query like Query, sorted
+// by time in order. TimeMicros is used when set, Time otherwise. Events with
+// the same time keep the order of the response.
+func (c *Client) QuerySorted(q string, order Order) ([]Event, error) {
+	events, err := c.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if order == NewestFirst {
+			return eventMicros(&events[i]) > eventMicros(&events[j])
+		}
+		return eventMicros(&events[i]) < eventMicros(&events[j])
+	})
+	return events, nil
+}
+
+// eventMicros returns the time of e in microseconds.
+func eventMicros(e *Event) int64 {
+	if e.TimeMicros != 0 {
+		return e.TimeMicros
+	}
+	return e.Time * 1e6
+}
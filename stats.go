@@ -0,0 +1,90 @@
+package raidman
+
+import (
+	"sync"
+	"time"
+)
+
+// rateWindow is the number of seconds send rates are averaged over.
+const rateWindow = 10
+
+// Stats reports on the activity of a Client.
+type Stats struct {
+	// SendRate is the number of events sent successfully per second,
+	// averaged over the last 10 seconds.
+	SendRate float64
+
+	// ConnID identifies the current connection of the Client, and
+	// changes each time it reconnects. Errors of the connection name it.
+	ConnID uint64
+
+	// Shed is the number of events ShouldSend dropped.
+	Shed uint64
+
+	// WriteLatency holds the durations of the sends of messages, if
+	// enabled with WithWriteLatency, and is empty otherwise.
+	WriteLatency LatencyHistogram
+}
+
+// Stats returns statistics about c. It does not wait for sends in progress.
+func (c *Client) Stats() Stats {
+	c.stats.Lock()
+	defer c.stats.Unlock()
+	return Stats{
+		SendRate:     c.stats.sent.rate(c.timeNow()),
+		ConnID:       c.connID.Load(),
+		Shed:         c.shed.Load(),
+		WriteLatency: c.latency.snapshot(),
+	}
+}
+
+// timeNow returns the current time, as told by the clock of c.
+func (c *Client) timeNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// clientStats holds the statistics of a Client behind their own lock, so
+// that reading them does not wait for the network.
+type clientStats struct {
+	sync.Mutex
+	sent     rateCounter
+	failures failureRing
+}
+
+// recordSent records that n events were sent at now.
+func (s *clientStats) recordSent(now time.Time, n int) {
+	s.Lock()
+	s.sent.add(now, n)
+	s.Unlock()
+}
+
+// rateCounter counts occurrences per second over a sliding window of
+// rateWindow seconds.
+type rateCounter struct {
+	counts  [rateWindow]uint64
+	seconds [rateWindow]int64
+}
+
+func (r *rateCounter) add(now time.Time, n int) {
+	second := now.Unix()
+	i := second % rateWindow
+	if r.seconds[i] != second {
+		r.seconds[i] = second
+		r.counts[i] = 0
+	}
+	r.counts[i] += uint64(n)
+}
+
+func (r *rateCounter) rate(now time.Time) float64 {
+	second := now.Unix()
+	var total uint64
+	for i, s := range r.seconds {
+		if second-s < rateWindow {
+			total += r.counts[i]
+		}
+	}
+	return float64(total) / rateWindow
+}
@@ -0,0 +1,30 @@
+package raidman
+
+import (
+	"io"
+	"net"
+)
+
+// tapConn copies every byte successfully written to its connection to tap.
+type tapConn struct {
+	net.Conn
+	tap io.Writer
+}
+
+func (c *tapConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		// Errors of the tap must not fail the send.
+		c.tap.Write(p[:n])
+	}
+	return n, err
+}
+
+// tapped returns conn, writing a copy of what is written to it to the
+// TapWriter of c if one is set.
+func (c *Client) tapped(conn net.Conn) net.Conn {
+	if c.TapWriter == nil {
+		return conn
+	}
+	return &tapConn{conn, c.TapWriter}
+}
@@ -0,0 +1,54 @@
+package raidman
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DialTLSContext establishes a TLS connection to a Riemann server at addr, on
+// the network netwrk, giving up when ctx is done before the connection is
+// established and the TLS handshake completes. Reconnections of the Client
+// use TLS too.
+//
+// Known networks are "tcp", "tcp4", and "tcp6": Riemann does not serve TLS
+// over UDP.
+func DialTLSContext(ctx context.Context, netwrk, addr string, config *tls.Config) (c *Client, err error) {
+	if strings.HasPrefix(netwrk, "udp") {
+		return nil, fmt.Errorf("dial %q: TLS is not supported over %q", addr, netwrk)
+	}
+	return dialContext(ctx, netwrk, addr, withTLS(config))
+}
+
+// withTLS makes a Client wrap its connections in TLS with config.
+func withTLS(config *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
+
+// handshake runs the client side of a TLS handshake over conn with the TLS
+// configuration of c. It verifies the host of addr unless the configuration
+// names a server.
+func (c *Client) handshake(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	config := c.tlsConfig
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(c.addr)
+		if err != nil {
+			host = c.addr
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
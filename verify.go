@@ -0,0 +1,42 @@
+package raidman
+
+import (
+	"strconv"
+	"time"
+)
+
+// verifyInterval is the time SendAndVerify waits between queries.
+const verifyInterval = 50 * time.Millisecond
+
+// SendAndVerify sends an event to Riemann, then queries for events with its
+// service and host, as sent, until one is found or timeout elapses, and
+// reports whether it was found. It is meant for integration tests, and needs
+// a TCP Client for querying. If the event is not sent, e.g. as ShouldSend
+// dropped it, it returns false right away.
+func (c *Client) SendAndVerify(event *Event, timeout time.Duration) (bool, error) {
+	events := []*Event{event}
+	message, err := c.message(events)
+	if err != nil || message == nil {
+		return false, err
+	}
+	e := message.Events[0]
+	q := "service = " + strconv.Quote(e.GetService()) + " and host = " + strconv.Quote(e.GetHost())
+	if err = c.sendBuilt(events, message, time.Time{}); err != nil {
+		return false, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		n, err := c.QueryCount(q)
+		if err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return true, nil
+		}
+		if time.Now().Add(verifyInterval).After(deadline) {
+			return false, nil
+		}
+		time.Sleep(verifyInterval)
+	}
+}
@@ -0,0 +1,79 @@
+package raidman
+
+import "github.com/amir/raidman/proto"
+
+// An EventView reads the fields of an event decoded from a response in place,
+// without copying them into an Event as Query does. It is valid only until
+// the callback it was passed to returns, and must not be modified; Event
+// copies what must outlive it.
+type EventView struct {
+	e *proto.Event
+}
+
+// QueryViews calls fn with a view of each event matched by query, in order,
+// decoded like QueryRaw, sparing the copy into Events for consumers reading
+// few fields of many events.
+func (c *Client) QueryViews(q string, fn func(v EventView)) error {
+	events, err := c.QueryRaw(q)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		fn(EventView{e})
+	}
+	return nil
+}
+
+// Service returns the service of the event.
+func (v EventView) Service() string { return v.e.GetService() }
+
+// Host returns the host of the event.
+func (v EventView) Host() string { return v.e.GetHost() }
+
+// State returns the state of the event.
+func (v EventView) State() string { return v.e.GetState() }
+
+// Description returns the description of the event.
+func (v EventView) Description() string { return v.e.GetDescription() }
+
+// Time returns the time of the event.
+func (v EventView) Time() int64 { return v.e.GetTime() }
+
+// TimeMicros returns the time in microseconds of the event.
+func (v EventView) TimeMicros() int64 { return v.e.GetTimeMicros() }
+
+// Ttl returns the ttl of the event.
+func (v EventView) Ttl() float32 { return v.e.GetTtl() }
+
+// Tags returns the tags of the event, which must not be modified.
+func (v EventView) Tags() []string { return v.e.GetTags() }
+
+// Metric returns the metric of the event as Query would, preferring
+// metric_sint64, then metric_d, then metric_f as a float64.
+func (v EventView) Metric() interface{} {
+	switch {
+	case v.e.MetricSint64 != nil:
+		return v.e.GetMetricSint64()
+	case v.e.MetricD != nil:
+		return v.e.GetMetricD()
+	case v.e.MetricF != nil:
+		return float64(v.e.GetMetricF())
+	}
+	return v.e.GetMetricSint64()
+}
+
+// Attribute returns the attribute key of the event. It returns false if the
+// event has no such attribute.
+func (v EventView) Attribute(key string) (string, bool) {
+	for _, attr := range v.e.GetAttributes() {
+		if attr.GetKey() == key {
+			return attr.GetValue(), true
+		}
+	}
+	return "", false
+}
+
+// Event copies the event into an Event, as Query returns it.
+func (v EventView) Event() Event {
+	return pbEventsToEvents([]*proto.Event{v.e})[0]
+}